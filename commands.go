@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tomashevich/server/database"
+	"tomashevich/server/middleware"
+	"tomashevich/server/utils"
+)
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(db *database.Database, config *utils.Config, args []string) error
+}
+
+// admin commands, run as `./tomashevich <command> [args]` next to running server
+var commands = []command{
+	{"cleanup-souls", "", "remove souls which never made api call", cleanupSouls},
+	{"pseudonymize-addresses", "", "hash raw addresses, when identity.address_keys are set after database was used without them", pseudonymizeAddresses},
+	{"erase-soul", "<id|address>", "erase soul by id or all souls of address (same as DELETE /souls/me)", eraseSoul},
+	{"ban", "<ip|cidr|soul:id> <duration|forever> [reason]", "ban client, duration like 24h", banCommand(false)},
+	{"allow", "<ip|cidr|soul:id> <duration|forever> [reason]", "put client to allowlist, it skips bans and rate limits", banCommand(true)},
+	{"unban", "<ban id>", "remove entry of ban list or allowlist", unban},
+	{"bans", "", "list bans and allows which are not expired", listBans},
+}
+
+func runCommand(db *database.Database, config *utils.Config, args []string) error {
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == args[0] })
+	if i == -1 {
+		printUsage()
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+
+	return commands[i].run(db, config, args[1:])
+}
+
+func printUsage() {
+	var usage strings.Builder
+	usage.WriteString("usage: tomashevich [command]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&usage, "  %s\n\t%s\n", strings.TrimSpace(c.name+" "+c.usage), c.description)
+	}
+	fmt.Fprint(os.Stderr, usage.String())
+}
+
+func cleanupSouls(db *database.Database, config *utils.Config, args []string) error {
+	removed, err := db.CleanupUnusedSouls(context.Background())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("removed %d souls\n", removed)
+	return nil
+}
+
+func pseudonymizeAddresses(db *database.Database, config *utils.Config, args []string) error {
+	hasher := utils.NewAddressHasher(config.Identity.AddressKeys)
+	if !hasher.Enabled() {
+		return fmt.Errorf("identity.address_keys is empty")
+	}
+
+	n, err := db.PseudonymizeAddresses(context.Background(), hasher.Hash)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("pseudonymized %d addresses\n", n)
+	return nil
+}
+
+func eraseSoul(db *database.Database, config *utils.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: erase-soul <id|address>")
+	}
+
+	ctx := context.Background()
+
+	ids := []int{}
+	if id, err := strconv.Atoi(args[0]); err == nil {
+		ids = append(ids, id)
+	} else {
+		// addresses are stored aggregated and hashed
+		hasher := utils.NewAddressHasher(config.Identity.AddressKeys)
+		address := utils.AggregateAddr(args[0], config.Server.IPv4Prefix, config.Server.IPv6Prefix)
+		for _, hash := range append([]string{hasher.Hash(address)}, hasher.PreviousHashes(address)...) {
+			addressIDs, err := db.GetSoulIDsByAddress(ctx, hash)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, addressIDs...)
+		}
+	}
+
+	for _, id := range ids {
+		if err := db.EraseSoul(ctx, id); err != nil {
+			return fmt.Errorf("soul %d: %w", id, err)
+		}
+		fmt.Printf("erased soul %d\n", id)
+	}
+
+	return nil
+}
+
+func banCommand(allow bool) func(db *database.Database, config *utils.Config, args []string) error {
+	return func(db *database.Database, config *utils.Config, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: <ip|cidr|soul:id> <duration|forever> [reason]")
+		}
+
+		target, err := middleware.ParseBanTarget(args[0])
+		if err != nil {
+			return err
+		}
+
+		// soul is checked only by signed cookie, without key rule would be ignored
+		if strings.HasPrefix(target, "soul:") && config.Identity.CookieKey == "" {
+			return fmt.Errorf("identity.cookie_key is empty, souls have no cookie and cant be matched, ban ip instead")
+		}
+
+		var expiresAt int64
+		if args[1] != "forever" {
+			duration, err := time.ParseDuration(args[1])
+			if err != nil || duration <= 0 {
+				return fmt.Errorf("invalid duration %q", args[1])
+			}
+			expiresAt = time.Now().Add(duration).Unix()
+		}
+
+		id, err := db.AddBan(context.Background(), target, allow, strings.Join(args[2:], " "), expiresAt)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("added %d %s, running server applies it in %d seconds\n", id, target, config.Bans.ReloadInterval)
+		return nil
+	}
+}
+
+func unban(db *database.Database, config *utils.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: unban <ban id>")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid ban id %q", args[0])
+	}
+
+	if err := db.RemoveBan(context.Background(), id); err != nil {
+		return err
+	}
+
+	fmt.Printf("removed %d\n", id)
+	return nil
+}
+
+func listBans(db *database.Database, config *utils.Config, args []string) error {
+	bans, err := db.GetBans(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, ban := range bans {
+		kind := "ban"
+		if ban.Allow {
+			kind = "allow"
+		}
+
+		expires := "forever"
+		if ban.ExpiresAt != 0 {
+			expires = time.Unix(ban.ExpiresAt, 0).UTC().Format(time.DateTime)
+		}
+
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\n", ban.Id, kind, ban.Target, expires, ban.Reason)
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	_ "embed"
 	"io/fs"
 	"log"
+	"os"
 
 	"tomashevich/server"
 	"tomashevich/server/database"
@@ -28,11 +29,29 @@ func main() {
 		log.Fatalf("cant load config file with err %s", err)
 	}
 
-	db, err := database.NewDatabase(config.DatabaseFile)
+	options := database.MigrationOptions{
+		AggregateAddress: func(ip string) string {
+			return utils.AggregateAddr(ip, config.Server.IPv4Prefix, config.Server.IPv6Prefix)
+		},
+	}
+	if hasher := utils.NewAddressHasher(config.Identity.AddressKeys); hasher.Enabled() {
+		options.HashAddress = hasher.Hash
+	}
+
+	db, err := database.NewDatabase(config.DatabaseFile, options)
 	if err != nil {
 		log.Fatalf("cant init storage with err %s", err.Error())
 	}
 
+	if len(os.Args) > 1 {
+		if err := runCommand(db, &config, os.Args[1:]); err != nil {
+			log.Fatalf("command %s failed with err %s", os.Args[1], err.Error())
+		}
+		return
+	}
+
 	s := server.NewServer(&config, staticFS, db)
-	log.Fatal(s.Run())
+	if err := s.Run(); err != nil {
+		log.Fatal(err)
+	}
 }
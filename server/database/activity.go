@@ -0,0 +1,24 @@
+package database
+
+import "context"
+
+// SaveActivity writes activity collected by helheim. FirstSeen starts new visit
+// if soul was not seen for gap seconds
+func (d Database) SaveActivity(ctx context.Context, activity []SoulActivity, gap int64) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range activity {
+		if _, err := tx.ExecContext(ctx, `UPDATE souls SET
+			visits = visits + ? + (last_seen_at IS NULL OR ? - last_seen_at > ?),
+			last_seen_at = MAX(COALESCE(last_seen_at, 0), ?)
+			WHERE id=?`, a.Visits, a.FirstSeen, gap, a.LastSeen, a.SoulID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
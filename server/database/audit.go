@@ -0,0 +1,18 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	AuditSoulExport = "soul_export"
+	AuditSoulClaim  = "soul_claim"
+)
+
+// WriteAudit writes soul_id as NULL for 0 (failed claim of visitor without soul)
+func (d Database) WriteAudit(ctx context.Context, soulID int, action, address string, success bool) error {
+	id := sql.NullInt64{Int64: int64(soulID), Valid: soulID != 0}
+	_, err := d.db.ExecContext(ctx, "INSERT INTO audits (soul_id, action, address, success) VALUES (?, ?, ?, ?)", id, action, address, success)
+	return err
+}
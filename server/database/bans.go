@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrBanNotFound = errors.New("ban not found")
+
+func (d Database) AddBan(ctx context.Context, target string, allow bool, reason string, expiresAt int64) (int, error) {
+	expires := sql.NullInt64{Int64: expiresAt, Valid: expiresAt != 0}
+
+	var id int
+	err := d.db.QueryRowContext(ctx, "INSERT INTO bans (target, allow, reason, expires_at) VALUES (?, ?, ?, ?) RETURNING id", target, allow, reason, expires).Scan(&id)
+	return id, err
+}
+
+func (d Database) RemoveBan(ctx context.Context, id int) error {
+	res, err := d.db.ExecContext(ctx, "DELETE FROM bans WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrBanNotFound
+	}
+
+	return nil
+}
+
+// GetBans returns bans and allows which are not expired, expired ones stay in table as history
+func (d Database) GetBans(ctx context.Context) ([]Ban, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT id, target, allow, reason, COALESCE(expires_at, 0), created_at FROM bans WHERE expires_at IS NULL OR expires_at > unixepoch() ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []Ban
+	for rows.Next() {
+		var ban Ban
+		if err := rows.Scan(&ban.Id, &ban.Target, &ban.Allow, &ban.Reason, &ban.ExpiresAt, &ban.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+
+	return bans, rows.Err()
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrCatchCooldown = errors.New("catch cooldown")
+
+// CatchFish adds seed to collection of soul, if soul caught anything after `since` its cooldown
+func (d Database) CatchFish(ctx context.Context, soulID int, seed string, since time.Time) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lastCaughtAt int64
+	if err := tx.QueryRowContext(ctx, "SELECT IFNULL(MAX(last_caught_at), 0) FROM catches WHERE soul_id=?", soulID).Scan(&lastCaughtAt); err != nil {
+		return err
+	}
+	if lastCaughtAt > since.Unix() {
+		return ErrCatchCooldown
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO catches (soul_id, seed) VALUES (?, ?)
+		ON CONFLICT (soul_id, seed) DO UPDATE SET count = count + 1, last_caught_at = unixepoch()`, soulID, seed); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d Database) GetCollection(ctx context.Context, soulID int) ([]Catch, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT seed, count, first_caught_at FROM catches WHERE soul_id=? ORDER BY first_caught_at", soulID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	catches := make([]Catch, 0)
+	for rows.Next() {
+		var catch Catch
+		if err := rows.Scan(&catch.Seed, &catch.Count, &catch.FirstCaughtAt); err != nil {
+			return nil, err
+		}
+		catches = append(catches, catch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return catches, nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrClaimTokenInvalid = errors.New("claim token is invalid, used or expired")
+
+// SetClaimToken replaces previous token of soul, so old exported token stops working
+func (d Database) SetClaimToken(ctx context.Context, soulID int, tokenHash string) error {
+	_, err := d.db.ExecContext(ctx, "INSERT OR REPLACE INTO claim_tokens (soul_id, token_hash) VALUES (?, ?)", soulID, tokenHash)
+	return err
+}
+
+// ClaimSoul consumes claim token made after since and binds its soul to address. Previous soul of caller
+// (0 => caller has no soul) is orphaned (gets placeholder address) but keeps his fish and pixels,
+// other souls on same address are not touched (they are other people behind same NAT)
+func (d Database) ClaimSoul(ctx context.Context, tokenHash string, since time.Time, callerID int, address string) (int, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var soulID int
+	err = tx.QueryRowContext(ctx, "DELETE FROM claim_tokens WHERE token_hash=? AND created_at>=? RETURNING soul_id", tokenHash, since.Unix()).Scan(&soulID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrClaimTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if soulID != callerID {
+		if callerID != 0 {
+			if _, err := tx.ExecContext(ctx, "UPDATE souls SET address = 'orphan:' || id WHERE id=?", callerID); err != nil {
+				return 0, err
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, "UPDATE souls SET address=?, cookie_bound=TRUE WHERE id=?", address, soulID)
+		if err != nil {
+			return 0, err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return 0, fmt.Errorf("soul %d not found", soulID)
+		}
+	}
+
+	return soulID, tx.Commit()
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+)
+
+// GetDailyFish returns fish of day, picking it if day has no fish yet.
+// Pick depends only on day and souls which were not featured before, and
+// its stored so restart or new souls dont change fish of today
+func (d Database) GetDailyFish(ctx context.Context, day string) (string, error) {
+	seed, err := d.getDailyFish(ctx, day)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return seed, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	hash := fnv.New64a()
+	hash.Write([]byte(day))
+
+	candidates := "FROM souls WHERE " + isFish + " AND seed NOT IN (SELECT seed FROM daily_fishes)"
+	var count int64
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) "+candidates).Scan(&count); err != nil {
+		return "", err
+	}
+	if count == 0 {
+		// every soul was featured, start again
+		candidates = "FROM souls WHERE " + isFish
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) "+candidates).Scan(&count); err != nil {
+			return "", err
+		}
+	}
+	if count == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	offset := int64(hash.Sum64() % uint64(count))
+	if err := tx.QueryRowContext(ctx, "SELECT seed "+candidates+" ORDER BY id LIMIT 1 OFFSET ?", offset).Scan(&seed); err != nil {
+		return "", err
+	}
+
+	// other request could pick fish at same time, first one wins
+	if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO daily_fishes (day, seed) VALUES (?, ?)", day, seed); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return d.getDailyFish(ctx, day)
+}
+
+func (d Database) getDailyFish(ctx context.Context, day string) (string, error) {
+	var seed string
+	err := d.db.QueryRowContext(ctx, "SELECT seed FROM daily_fishes WHERE day=?", day).Scan(&seed)
+	return seed, err
+}
+
+func (d Database) GetDailyHistory(ctx context.Context, limit, offset int64) ([]DailyFish, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT day, seed FROM daily_fishes ORDER BY day DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	history := make([]DailyFish, 0)
+	for rows.Next() {
+		var daily DailyFish
+		if err := rows.Scan(&daily.Day, &daily.Seed); err != nil {
+			return nil, err
+		}
+		history = append(history, daily)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
@@ -13,7 +13,7 @@ type Database struct {
 	db *sql.DB
 }
 
-func NewDatabase(pathToDatabase string) (*Database, error) {
+func NewDatabase(pathToDatabase string, options MigrationOptions) (*Database, error) {
 	os.MkdirAll(filepath.Dir(pathToDatabase), os.ModePerm)
 
 	db, err := sql.Open("sqlite3", pathToDatabase)
@@ -28,6 +28,10 @@ func NewDatabase(pathToDatabase string) (*Database, error) {
 	enablePragmas(db)
 	createTables(db)
 
+	if err := migrate(db, options); err != nil {
+		return nil, err
+	}
+
 	return &Database{
 		db,
 	}, nil
@@ -51,6 +55,19 @@ func createTables(db *sql.DB) error {
 	tables := []string{
 		"CREATE TABLE IF NOT EXISTS souls (id INTEGER PRIMARY KEY, address VARCHAR(39) NOT NULL UNIQUE, seed VARCHAR(32), painted_pixels INTEGER NOT NULL DEFAULT 0)",
 		"CREATE TABLE IF NOT EXISTS pixels (soul_id INTEGER NOT NULL REFERENCES souls(id), color INTEGER NOT NULL, x INT NOT NULL, y INT NOT NULL, PRIMARY KEY (x, y))",
+		"CREATE TABLE IF NOT EXISTS seed_history (soul_id INTEGER NOT NULL REFERENCES souls(id), seed VARCHAR(32) NOT NULL, replaced_at INTEGER NOT NULL DEFAULT (unixepoch()))",
+		"CREATE INDEX IF NOT EXISTS seed_history_soul_id ON seed_history (soul_id, replaced_at)",
+		"CREATE INDEX IF NOT EXISTS seed_history_seed ON seed_history (seed)",
+		"CREATE TABLE IF NOT EXISTS lineage (seed VARCHAR(36) PRIMARY KEY, parent_a VARCHAR(36) NOT NULL, parent_b VARCHAR(36) NOT NULL, bred_by INTEGER NOT NULL REFERENCES souls(id), created_at INTEGER NOT NULL DEFAULT (unixepoch()))",
+		"CREATE INDEX IF NOT EXISTS lineage_parent_a ON lineage (parent_a)",
+		"CREATE INDEX IF NOT EXISTS lineage_parent_b ON lineage (parent_b)",
+		"CREATE INDEX IF NOT EXISTS lineage_bred_by ON lineage (bred_by, created_at)",
+		"CREATE TABLE IF NOT EXISTS catches (soul_id INTEGER NOT NULL REFERENCES souls(id), seed VARCHAR(36) NOT NULL, count INTEGER NOT NULL DEFAULT 1, first_caught_at INTEGER NOT NULL DEFAULT (unixepoch()), last_caught_at INTEGER NOT NULL DEFAULT (unixepoch()), PRIMARY KEY (soul_id, seed))",
+		"CREATE TABLE IF NOT EXISTS daily_fishes (day VARCHAR(10) PRIMARY KEY, seed VARCHAR(36) NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS claim_tokens (soul_id INTEGER PRIMARY KEY REFERENCES souls(id), token_hash VARCHAR(64) NOT NULL UNIQUE, created_at INTEGER NOT NULL DEFAULT (unixepoch()))",
+		"CREATE TABLE IF NOT EXISTS audits (id INTEGER PRIMARY KEY, soul_id INTEGER, action VARCHAR(32) NOT NULL, address VARCHAR(39) NOT NULL, success BOOLEAN NOT NULL, created_at INTEGER NOT NULL DEFAULT (unixepoch()))",
+		"CREATE TABLE IF NOT EXISTS rate_limits (name VARCHAR(32) NOT NULL, policy VARCHAR(255) NOT NULL, limit_key VARCHAR(255) NOT NULL, state TEXT NOT NULL, PRIMARY KEY (name, policy, limit_key))",
+		"CREATE TABLE IF NOT EXISTS bans (id INTEGER PRIMARY KEY, target VARCHAR(64) NOT NULL, allow BOOLEAN NOT NULL DEFAULT FALSE, reason TEXT NOT NULL DEFAULT '', expires_at INTEGER, created_at INTEGER NOT NULL DEFAULT (unixepoch()))",
 	}
 	tx, err := db.Begin()
 	if err != nil {
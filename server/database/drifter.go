@@ -0,0 +1,16 @@
+package database
+
+import "context"
+
+// drifter is soul shared by visitors of network which made too many new souls
+const drifterAddress = "drifter"
+
+// isFish filters souls which are fishes: drifter has seed (visitors see its fish) but its not own fish of anyone,
+// so it is not listed, searched, sampled or picked as fish of day
+const isFish = "seed IS NOT NULL AND address NOT IN ('" + drifterAddress + "', '" + tombstoneAddress + "')"
+
+func (d Database) GetDrifterID(ctx context.Context) (int, error) {
+	var id int
+	err := d.db.QueryRowContext(ctx, "SELECT id FROM souls WHERE address=?", drifterAddress).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+const tombstoneAddress = "tombstone"
+
+var ErrTombstone = errors.New("tombstone cant be erased")
+
+var ErrDrifter = errors.New("drifter soul is shared, it cant be erased")
+
+// EraseSoul removes soul with his address, seed history, catches and claim token.
+// Painted pixels and bred fishes are given to tombstone soul, audits of soul lose address
+func (d Database) EraseSoul(ctx context.Context, id int) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tombstoneID int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM souls WHERE address=?", tombstoneAddress).Scan(&tombstoneID); err != nil {
+		return err
+	}
+	if id == tombstoneID {
+		return ErrTombstone
+	}
+
+	var drifterID int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM souls WHERE address=?", drifterAddress).Scan(&drifterID); err != nil {
+		return err
+	}
+	if id == drifterID {
+		return ErrDrifter
+	}
+
+	statements := []string{
+		"UPDATE pixels SET soul_id=? WHERE soul_id=?",
+		"UPDATE lineage SET bred_by=? WHERE bred_by=?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, tombstoneID, id); err != nil {
+			return err
+		}
+	}
+
+	statements = []string{
+		"DELETE FROM seed_history WHERE soul_id=?",
+		"DELETE FROM catches WHERE soul_id=?",
+		"DELETE FROM claim_tokens WHERE soul_id=?",
+		"UPDATE audits SET soul_id=NULL, address='' WHERE soul_id=?",
+		"DELETE FROM souls WHERE id=?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetSoulIDsByAddress for admin, when soul is known only by ip
+func (d Database) GetSoulIDsByAddress(ctx context.Context, address string) ([]int, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT id FROM souls WHERE address=?", address)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
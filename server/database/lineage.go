@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrBreedLimit = errors.New("breed limit reached")
+
+const countBreedsQuery = "SELECT COUNT(*) FROM lineage WHERE bred_by=? AND created_at>?"
+
+// parents are stored sorted, same as child seed is derived from them
+func sortParents(parentA, parentB string) (string, string) {
+	return min(parentA, parentB), max(parentA, parentB)
+}
+
+// GetChild returns seed bred from parents before, sql.ErrNoRows if they never bred
+func (d Database) GetChild(ctx context.Context, parentA, parentB string) (string, error) {
+	parentA, parentB = sortParents(parentA, parentB)
+
+	var child string
+	err := d.db.QueryRowContext(ctx, "SELECT seed FROM lineage WHERE parent_a=? AND parent_b=? LIMIT 1", parentA, parentB).Scan(&child)
+	return child, err
+}
+
+// CheckBreedLimit returns ErrBreedLimit if soul bred limit of new fishes since, its checked
+// before child is searched (thats expensive), BreedFish checks it again
+func (d Database) CheckBreedLimit(ctx context.Context, soulID int, since time.Time, limit int) error {
+	var breeds int
+	if err := d.db.QueryRowContext(ctx, countBreedsQuery, soulID, since.Unix()).Scan(&breeds); err != nil {
+		return err
+	}
+	if breeds >= limit {
+		return ErrBreedLimit
+	}
+	return nil
+}
+
+// BreedFish stores child with parents. Same parents always give same child,
+// so if child already exists its not counted in limit of soul
+func (d Database) BreedFish(ctx context.Context, child, parentA, parentB string, soulID int, since time.Time, limit int) error {
+	parentA, parentB = sortParents(parentA, parentB)
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM lineage WHERE seed=?", child).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	var breeds int
+	if err := tx.QueryRowContext(ctx, countBreedsQuery, soulID, since.Unix()).Scan(&breeds); err != nil {
+		return err
+	}
+	if breeds >= limit {
+		return ErrBreedLimit
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO lineage (seed, parent_a, parent_b, bred_by) VALUES (?, ?, ?, ?)", child, parentA, parentB, soulID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAncestors returns lineage of seed and all his bred ancestors up to depth
+func (d Database) GetAncestors(ctx context.Context, seed string, depth int) ([]Lineage, error) {
+	rows, err := d.db.QueryContext(ctx, `WITH RECURSIVE ancestors(seed, depth) AS (
+		SELECT ?, 0
+		UNION
+		SELECT p.parent, a.depth + 1 FROM ancestors a
+		JOIN (SELECT seed, parent_a AS parent FROM lineage UNION ALL SELECT seed, parent_b FROM lineage) p ON p.seed = a.seed
+		WHERE a.depth < ?
+	)
+	SELECT l.seed, l.parent_a, l.parent_b, l.bred_by, l.created_at FROM lineage l WHERE l.seed IN (SELECT seed FROM ancestors)`, seed, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var lineages []Lineage
+	for rows.Next() {
+		var lineage Lineage
+		if err := rows.Scan(&lineage.Seed, &lineage.ParentA, &lineage.ParentB, &lineage.BredBy, &lineage.CreatedAt); err != nil {
+			return nil, err
+		}
+		lineages = append(lineages, lineage)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lineages, nil
+}
+
+func (d Database) GetChildren(ctx context.Context, seed string) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT seed FROM lineage WHERE parent_a=? OR parent_b=? ORDER BY created_at", seed, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	children := make([]string, 0)
+	for rows.Next() {
+		var child string
+		if err := rows.Scan(&child); err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return children, nil
+}
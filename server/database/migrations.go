@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+type migration struct {
+	statements []string
+	// convert changes stored data which needs config (so cant be done by sql), runs after statements
+	convert func(ctx context.Context, tx *sql.Tx, options MigrationOptions) error
+}
+
+// MigrationOptions are parts of config which migrations of stored data need
+type MigrationOptions struct {
+	AggregateAddress func(ip string) string // ip => network by server.ipv4_prefix and server.ipv6_prefix
+	HashAddress      func(string) string    // hmac of identity.address_keys, nil => addresses are stored as is
+}
+
+// migrations change tables made by createTables. Every migration is applied once,
+// number of applied ones is stored in PRAGMA user_version.
+// Never change applied migration, add new one to the end
+var migrations = []migration{
+	// 1: soul is identified by cookie, so many souls can share address
+	{statements: []string{
+		"CREATE TABLE souls_new (id INTEGER PRIMARY KEY, address VARCHAR(39) NOT NULL, seed VARCHAR(32), painted_pixels INTEGER NOT NULL DEFAULT 0, cookie_bound BOOLEAN NOT NULL DEFAULT FALSE)",
+		"INSERT INTO souls_new (id, address, seed, painted_pixels) SELECT id, address, seed, painted_pixels FROM souls",
+		"DROP TABLE souls",
+		"ALTER TABLE souls_new RENAME TO souls",
+		"CREATE INDEX souls_address ON souls (address)",
+		"CREATE INDEX souls_seed ON souls (seed)",
+	}},
+	// 2: souls which never made api call can be removed. Old server made soul for every request,
+	// so existing souls are unused until they come back
+	{statements: []string{
+		"ALTER TABLE souls ADD COLUMN api_used BOOLEAN NOT NULL DEFAULT FALSE",
+	}},
+	// 3: erased souls give pixels and bred fishes to tombstone, it has no seed so its not a fish
+	{statements: []string{
+		"INSERT INTO souls (address, seed, cookie_bound, api_used) VALUES ('" + tombstoneAddress + "', NULL, TRUE, TRUE)",
+	}},
+	// 4: activity of souls, old souls have no created_at
+	{statements: []string{
+		"ALTER TABLE souls ADD COLUMN created_at INTEGER",
+		"ALTER TABLE souls ADD COLUMN last_seen_at INTEGER",
+		"ALTER TABLE souls ADD COLUMN visits INTEGER NOT NULL DEFAULT 0",
+	}},
+	// 5: visitors over new souls cap of their network share drifter soul, it cant paint
+	{statements: []string{
+		"INSERT INTO souls (address, seed, cookie_bound, api_used, created_at) VALUES ('" + drifterAddress + "', 'drifter', TRUE, TRUE, unixepoch())",
+	}},
+	// 6: parents of bred fish are sorted like in child seed, so pair is stored one way
+	{statements: []string{
+		"UPDATE lineage SET parent_a=parent_b, parent_b=parent_a WHERE parent_a > parent_b",
+	}},
+	// 7: addresses of souls are aggregated to network (ipv6 /64) like new ones, otherwise old souls without cookie are lost
+	{convert: aggregateAddresses},
+	// 8: raw addresses of souls and audits are hashed (after aggregation, so hash is of network like new ones)
+	{convert: pseudonymizeAddresses},
+}
+
+func migrate(db *sql.DB, options MigrationOptions) error {
+	ctx := context.Background()
+
+	// pragmas are per connection, so whole migration goes in one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var version int
+	if err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	if version >= len(migrations) {
+		return nil
+	}
+
+	// tables are rebuilt, foreign keys cant be changed inside transaction
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	for ; version < len(migrations); version++ {
+		if err := applyMigration(ctx, conn, version+1, migrations[version], options); err != nil {
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, version int, m migration, options MigrationOptions) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range m.statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if m.convert != nil {
+		if err := m.convert(ctx, tx, options); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// aggregateAddresses converts raw addresses of souls (hashes are skipped). Old server stored
+// ipv6 of connection as "[2001" (everything after first colon was cut), its not possible to recover, so its kept
+func aggregateAddresses(ctx context.Context, tx *sql.Tx, options MigrationOptions) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, address FROM souls WHERE address LIKE '%.%' OR address LIKE '%:%'")
+	if err != nil {
+		return err
+	}
+
+	aggregated := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var address string
+		if err := rows.Scan(&id, &address); err != nil {
+			rows.Close()
+			return err
+		}
+
+		addr, err := netip.ParseAddr(strings.TrimSpace(address))
+		if err != nil {
+			continue
+		}
+		if network := options.AggregateAddress(addr.Unmap().String()); network != address {
+			aggregated[id] = network
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, address := range aggregated {
+		if _, err := tx.ExecContext(ctx, "UPDATE souls SET address=? WHERE id=?", address, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -5,6 +5,37 @@ type Soul struct {
 	Address       string `json:"-"`
 	Seed          string `json:"seed"`
 	PaintedPixels int    `json:"painted_pixels"`
+	CookieBound   bool   `json:"-"`
+	CreatedAt     int64  `json:"created_at"`   // 0 => made before activity was tracked
+	LastSeenAt    int64  `json:"last_seen_at"` // 0 => not seen yet
+	Visits        int    `json:"visits"`
+}
+
+// SoulActivity is what helheim saw from soul since last write
+type SoulActivity struct {
+	SoulID    int
+	FirstSeen int64
+	LastSeen  int64
+	Visits    int // visits after FirstSeen
+}
+
+type Lineage struct {
+	Seed      string `json:"seed"`
+	ParentA   string `json:"parent_a"`
+	ParentB   string `json:"parent_b"`
+	BredBy    int    `json:"-"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type Catch struct {
+	Seed          string `json:"seed"`
+	Count         int    `json:"count"`
+	FirstCaughtAt int64  `json:"first_caught_at"`
+}
+
+type DailyFish struct {
+	Day  string `json:"day"`
+	Seed string `json:"seed"`
 }
 
 type Pixel struct {
@@ -19,3 +50,20 @@ type PixelPosition struct {
 	X int `json:"x"`
 	Y int `json:"y"`
 }
+
+// RateLimitState is state of one key of rate limiter, State is json of limiter algorithm
+type RateLimitState struct {
+	Policy string
+	Key    string
+	State  string
+}
+
+// Ban is entry of ban list (or allowlist if Allow), Target is ip/cidr or soul:<id>
+type Ban struct {
+	Id        int    `json:"id"`
+	Target    string `json:"target"`
+	Allow     bool   `json:"allow"`
+	Reason    string `json:"reason"`
+	ExpiresAt int64  `json:"expires_at"` // 0 => never
+	CreatedAt int64  `json:"created_at"`
+}
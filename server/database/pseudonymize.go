@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/netip"
+	"strings"
+)
+
+// isRawAddress is true for ip or network, hashes and tombstone/orphan placeholders are not
+func isRawAddress(address string) bool {
+	if _, err := netip.ParseAddr(address); err == nil {
+		return true
+	}
+	_, err := netip.ParsePrefix(address)
+	return err == nil
+}
+
+// PseudonymizeAddresses hashes raw addresses of souls and audits, for database which was used
+// without identity.address_keys before (migration hashes addresses only if keys are set).
+// Its safe to run many times, hashed rows are skipped
+func (d Database) PseudonymizeAddresses(ctx context.Context, hash func(string) string) (int, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	updated, err := hashRawAddresses(ctx, tx, hash)
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, tx.Commit()
+}
+
+// pseudonymizeAddresses is migration of raw addresses left from times before hashing
+func pseudonymizeAddresses(ctx context.Context, tx *sql.Tx, options MigrationOptions) error {
+	if options.HashAddress == nil {
+		return nil
+	}
+
+	_, err := hashRawAddresses(ctx, tx, options.HashAddress)
+	return err
+}
+
+func hashRawAddresses(ctx context.Context, tx *sql.Tx, hash func(string) string) (int, error) {
+	updated := 0
+	for _, table := range []string{"souls", "audits"} {
+		// hashes are hex, only raw addresses have . or :
+		rows, err := tx.QueryContext(ctx, "SELECT id, address FROM "+table+" WHERE address LIKE '%.%' OR address LIKE '%:%'")
+		if err != nil {
+			return 0, err
+		}
+
+		raw := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var address string
+			if err := rows.Scan(&id, &address); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			if isRawAddress(strings.TrimSpace(address)) {
+				raw[id] = address
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for id, address := range raw {
+			if _, err := tx.ExecContext(ctx, "UPDATE "+table+" SET address=? WHERE id=?", hash(address), id); err != nil {
+				return 0, err
+			}
+		}
+		updated += len(raw)
+	}
+
+	return updated, nil
+}
+
+// RehashAddress moves souls from hashes of old keys to hash of current key, false if there was nothing to move
+func (d Database) RehashAddress(ctx context.Context, previous []string, current string) (bool, error) {
+	if len(previous) == 0 {
+		return false, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(previous)), ", ")
+	args := []any{current}
+	for _, hash := range previous {
+		args = append(args, hash)
+	}
+
+	// read first, so miss dont take write lock
+	var exists int
+	if err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM (SELECT 1 FROM souls WHERE address IN ("+placeholders+") LIMIT 1)", args[1:]...).Scan(&exists); err != nil || exists == 0 {
+		return false, err
+	}
+
+	res, err := d.db.ExecContext(ctx, "UPDATE souls SET address=? WHERE address IN ("+placeholders+")", args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -2,11 +2,17 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
 	"strings"
+	"unicode/utf8"
 )
 
+// GiveSoulToHel makes soul which is not bound to cookie, so visitor without cookie gets it again
+// until cookie comes back (BindSoul)
 func (d Database) GiveSoulToHel(ctx context.Context, seed, address string) (int, error) {
-	row := d.db.QueryRowContext(ctx, "INSERT INTO souls (seed, address) VALUES (?, ?) RETURNING id", seed, address)
+	row := d.db.QueryRowContext(ctx, "INSERT INTO souls (seed, address, api_used, created_at) VALUES (?, ?, TRUE, unixepoch()) RETURNING id", seed, address)
 
 	var id int
 	if row.Err() != nil {
@@ -37,14 +43,14 @@ func (d Database) GetSeed(ctx context.Context, id int) (string, error) {
 }
 
 func (d Database) GetSoul(ctx context.Context, id int) (Soul, error) {
-	row := d.db.QueryRowContext(ctx, "SELECT * FROM souls WHERE id=?", id)
+	row := d.db.QueryRowContext(ctx, "SELECT id, address, seed, painted_pixels, cookie_bound, COALESCE(created_at, 0), COALESCE(last_seen_at, 0), visits FROM souls WHERE id=?", id)
 
 	var soul Soul
 	if row.Err() != nil {
 		return soul, row.Err()
 	}
 
-	if err := row.Scan(&soul.Id, &soul.Address, &soul.Seed, &soul.PaintedPixels); err != nil {
+	if err := row.Scan(&soul.Id, &soul.Address, &soul.Seed, &soul.PaintedPixels, &soul.CookieBound, &soul.CreatedAt, &soul.LastSeenAt, &soul.Visits); err != nil {
 		return soul, err
 	}
 
@@ -52,7 +58,90 @@ func (d Database) GetSoul(ctx context.Context, id int) (Soul, error) {
 }
 
 func (d Database) GetSoulIDByIP(ctx context.Context, address string) (int, error) {
-	row := d.db.QueryRowContext(ctx, "SELECT id FROM souls WHERE address=?", address)
+	row := d.db.QueryRowContext(ctx, "SELECT id FROM souls WHERE address=? ORDER BY id LIMIT 1", address)
+
+	var id int
+	if row.Err() != nil {
+		return id, row.Err()
+	}
+
+	if err := row.Scan(&id); err != nil {
+		return id, err
+	}
+
+	return id, nil
+}
+
+// GetUnboundSoulIDByIP returns soul of address which has no cookie yet
+func (d Database) GetUnboundSoulIDByIP(ctx context.Context, address string) (int, error) {
+	row := d.db.QueryRowContext(ctx, "SELECT id FROM souls WHERE address=? AND NOT cookie_bound ORDER BY id LIMIT 1", address)
+
+	var id int
+	if row.Err() != nil {
+		return id, row.Err()
+	}
+
+	if err := row.Scan(&id); err != nil {
+		return id, err
+	}
+
+	return id, nil
+}
+
+// BindSoul marks soul as owned by cookie, when cookie came back with it. Returns false if it was bound already
+func (d Database) BindSoul(ctx context.Context, id int) (bool, error) {
+	res, err := d.db.ExecContext(ctx, "UPDATE souls SET cookie_bound=TRUE WHERE id=? AND NOT cookie_bound", id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GetSoulFlags returns api_used and cookie_bound of soul, sql.ErrNoRows if soul not exists
+func (d Database) GetSoulFlags(ctx context.Context, id int) (bool, bool, error) {
+	row := d.db.QueryRowContext(ctx, "SELECT api_used, cookie_bound FROM souls WHERE id=?", id)
+
+	var used, bound bool
+	if err := row.Scan(&used, &bound); err != nil {
+		return false, false, err
+	}
+
+	return used, bound, nil
+}
+
+func (d Database) MarkSoulUsedAPI(ctx context.Context, id int) error {
+	_, err := d.db.ExecContext(ctx, "UPDATE souls SET api_used=TRUE WHERE id=?", id)
+	return err
+}
+
+// DeleteNewSoul removes soul made by failed request, soul which already painted is kept
+func (d Database) DeleteNewSoul(ctx context.Context, id int) error {
+	_, err := d.db.ExecContext(ctx, "DELETE FROM souls WHERE id=? AND painted_pixels=0", id)
+	return err
+}
+
+// CleanupUnusedSouls removes souls which never made api call and have nothing
+// (made by old helheim for every request, crawlers included)
+func (d Database) CleanupUnusedSouls(ctx context.Context) (int64, error) {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM souls WHERE NOT api_used AND painted_pixels=0
+		AND id NOT IN (SELECT soul_id FROM pixels)
+		AND id NOT IN (SELECT soul_id FROM seed_history)
+		AND id NOT IN (SELECT bred_by FROM lineage)
+		AND id NOT IN (SELECT soul_id FROM catches)
+		AND id NOT IN (SELECT soul_id FROM claim_tokens)
+		AND seed NOT IN (SELECT seed FROM daily_fishes)`)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// GetSoulIDBySeed returns sql.ErrNoRows for drifter, its fish cant be caught
+func (d Database) GetSoulIDBySeed(ctx context.Context, seed string) (int, error) {
+	row := d.db.QueryRowContext(ctx, "SELECT id FROM souls WHERE seed=? AND "+isFish, seed)
 
 	var id int
 	if row.Err() != nil {
@@ -67,7 +156,186 @@ func (d Database) GetSoulIDByIP(ctx context.Context, address string) (int, error
 }
 
 func (d Database) GetSeeds(ctx context.Context, limit, offset int64) ([]string, error) {
-	rows, err := d.db.Query("SELECT seed FROM souls ORDER BY seed DESC LIMIT ? OFFSET ?", limit, offset)
+	rows, err := d.db.Query("SELECT seed FROM souls WHERE "+isFish+" ORDER BY seed DESC LIMIT ? OFFSET ?", limit, offset)
+	var seeds []string
+
+	if err != nil {
+		return seeds, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var seed string
+		if err := rows.Scan(&seed); err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return seeds, nil
+}
+
+// GetRandomSeeds picks random ids below max id instead of ORDER BY RANDOM() which scans whole table.
+// Missing ids are retried few times, then rest is taken from range of ids after random one (gaps left by erased souls)
+func (d Database) GetRandomSeeds(ctx context.Context, n int) ([]string, error) {
+	var maxID int
+	if err := d.db.QueryRowContext(ctx, "SELECT IFNULL(MAX(id), 0) FROM souls").Scan(&maxID); err != nil {
+		return nil, err
+	}
+
+	seeds := make([]string, 0, n)
+	if maxID == 0 {
+		return seeds, nil
+	}
+
+	tried := make(map[int]bool)
+	for range 5 {
+		need := n - len(seeds)
+		if need <= 0 || len(tried) >= maxID {
+			break
+		}
+
+		ids := make([]any, 0, need*2)
+		for len(ids) < need*2 && len(tried) < maxID {
+			id := rand.IntN(maxID) + 1
+			if tried[id] {
+				continue
+			}
+			tried[id] = true
+			ids = append(ids, id)
+		}
+
+		query := "SELECT seed FROM souls WHERE " + isFish + " AND id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ") LIMIT ?"
+		found, err := d.querySeeds(ctx, query, append(ids, need)...)
+		if err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, found...)
+	}
+
+	if len(seeds) < n && len(tried) < maxID {
+		var err error
+		if seeds, err = d.fillSeedsFromRange(ctx, seeds, n, rand.IntN(maxID)+1); err != nil {
+			return nil, err
+		}
+	}
+
+	// IN and range return rows ordered by id
+	rand.Shuffle(len(seeds), func(i, j int) { seeds[i], seeds[j] = seeds[j], seeds[i] })
+	return seeds, nil
+}
+
+// fillSeedsFromRange adds seeds with id from start (and then from beginning of table) until there are n,
+// both queries go by primary key, so its cheap even if most ids are missing
+func (d Database) fillSeedsFromRange(ctx context.Context, seeds []string, n, start int) ([]string, error) {
+	picked := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		picked[seed] = true
+	}
+
+	for _, query := range []string{
+		"SELECT seed FROM souls WHERE " + isFish + " AND id >= ? ORDER BY id LIMIT ?",
+		"SELECT seed FROM souls WHERE " + isFish + " AND id < ? ORDER BY id LIMIT ?",
+	} {
+		found, err := d.querySeeds(ctx, query, start, n)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, seed := range found {
+			if len(seeds) >= n {
+				return seeds, nil
+			}
+			if !picked[seed] {
+				picked[seed] = true
+				seeds = append(seeds, seed)
+			}
+		}
+	}
+
+	return seeds, nil
+}
+
+func (d Database) querySeeds(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var seeds []string
+	for rows.Next() {
+		var seed string
+		if err := rows.Scan(&seed); err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return seeds, nil
+}
+
+// SearchSeeds finds seeds starting with prefix. Range instead of LIKE, so souls_seed index is used
+func (d Database) SearchSeeds(ctx context.Context, prefix string, limit, offset int64) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT seed FROM souls WHERE "+isFish+" AND seed >= ? AND seed < ? ORDER BY seed LIMIT ? OFFSET ?", prefix, prefix+string(utf8.MaxRune), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	seeds := make([]string, 0)
+	for rows.Next() {
+		var seed string
+		if err := rows.Scan(&seed); err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return seeds, nil
+}
+
+func (d Database) GetRecentSeeds(ctx context.Context, n int) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT seed FROM souls WHERE "+isFish+" ORDER BY id DESC LIMIT ?", n)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	seeds := make([]string, 0, n)
+	for rows.Next() {
+		var seed string
+		if err := rows.Scan(&seed); err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return seeds, nil
+}
+
+func (d Database) GetAllSeeds(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT seed FROM souls WHERE "+isFish)
 	var seeds []string
 
 	if err != nil {
@@ -91,6 +359,21 @@ func (d Database) GetSeeds(ctx context.Context, limit, offset int64) ([]string,
 	return seeds, nil
 }
 
+func (d Database) IsSeedExists(ctx context.Context, seed string) (bool, error) {
+	// rerolled and bred seeds are fishes too
+	row := d.db.QueryRowContext(ctx, "SELECT 1 FROM souls WHERE seed=? AND "+isFish+" UNION ALL SELECT 1 FROM seed_history WHERE seed=? UNION ALL SELECT 1 FROM lineage WHERE seed=? LIMIT 1", seed, seed, seed)
+
+	var exists int
+	if err := row.Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
 func (d Database) GetPixels(ctx context.Context) ([]Pixel, error) {
 	rows, err := d.db.QueryContext(ctx, "SELECT * FROM pixels")
 	var pixels []Pixel
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "storage.db"), MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.db.Close() })
+
+	return db
+}
+
+func TestCleanupUnusedSouls(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	// soul of old server, made for request which never touched api
+	var unused int
+	if err := db.db.QueryRowContext(ctx, "INSERT INTO souls (seed, address) VALUES ('unused', '10.0.0.1') RETURNING id").Scan(&unused); err != nil {
+		t.Fatal(err)
+	}
+
+	// soul of old server which came back
+	var returned int
+	if err := db.db.QueryRowContext(ctx, "INSERT INTO souls (seed, address) VALUES ('returned', '10.0.0.2') RETURNING id").Scan(&returned); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkSoulUsedAPI(ctx, returned); err != nil {
+		t.Fatal(err)
+	}
+
+	made, err := db.GiveSoulToHel(ctx, "made", "10.0.0.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := db.CleanupUnusedSouls(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("removed %d souls, want 1", removed)
+	}
+
+	if _, _, err := db.GetSoulFlags(ctx, unused); err == nil {
+		t.Fatal("unused soul is not removed")
+	}
+	for _, id := range []int{returned, made} {
+		if _, _, err := db.GetSoulFlags(ctx, id); err != nil {
+			t.Fatalf("soul %d is removed: %v", id, err)
+		}
+	}
+
+	// tombstone and drifter are used, cleanup dont touch them
+	if _, err := db.GetDrifterID(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// drifter soul has seed "drifter" (visitors see its fish), but it cant be target of breeding, catch or traits
+func TestDrifterIsNotFish(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	if _, err := db.GetSoulIDBySeed(ctx, "drifter"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("drifter is found by seed, err %v", err)
+	}
+
+	exists, err := db.IsSeedExists(ctx, "drifter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("drifter seed exists")
+	}
+
+	if _, err := db.GiveSoulToHel(ctx, "fish", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := db.IsSeedExists(ctx, "fish"); err != nil || !exists {
+		t.Fatalf("fish seed dont exist, err %v", err)
+	}
+}
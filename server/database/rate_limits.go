@@ -0,0 +1,43 @@
+package database
+
+import "context"
+
+// SaveRateLimits replaces saved states of rate limiter
+func (d Database) SaveRateLimits(ctx context.Context, name string, states []RateLimitState) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM rate_limits WHERE name=?", name); err != nil {
+		return err
+	}
+
+	for _, state := range states {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO rate_limits (name, policy, limit_key, state) VALUES (?, ?, ?, ?)", name, state.Policy, state.Key, state.State); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d Database) GetRateLimits(ctx context.Context, name string) ([]RateLimitState, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT policy, limit_key, state FROM rate_limits WHERE name=?", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []RateLimitState
+	for rows.Next() {
+		var state RateLimitState
+		if err := rows.Scan(&state.Policy, &state.Key, &state.State); err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrRerollLimit = errors.New("reroll limit reached")
+
+// RerollSeed gives soul new seed and keeps old one in seed_history.
+// Returns how many rerolls left since `since`
+func (d Database) RerollSeed(ctx context.Context, soulID int, seed string, since time.Time, limit int) (int, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var rerolls int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM seed_history WHERE soul_id=? AND replaced_at>?", soulID, since.Unix()).Scan(&rerolls); err != nil {
+		return 0, err
+	}
+
+	if rerolls >= limit {
+		return 0, ErrRerollLimit
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO seed_history (soul_id, seed) SELECT id, seed FROM souls WHERE id=?", soulID); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE souls SET seed=? WHERE id=?", seed, soulID); err != nil {
+		return 0, err
+	}
+
+	return limit - rerolls - 1, tx.Commit()
+}
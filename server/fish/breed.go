@@ -0,0 +1,61 @@
+package fish
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// there are only few thousands of different fishes (seed is sum of chars), so its enough to find good child
+const breedAttempts = 4096
+
+var breedNamespace = uuid.MustParse("5f1c0a4e-8b1d-4a52-9a3e-6d2f7c1b9e40")
+
+// Breed returns child seed of two fishes. Its deterministic and dont depend on order of parents.
+// Child seeds are uuid v5 from parents and attempt number, we take first one which
+// inherits all traits from parents and has something from both of them
+func Breed(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	parentA, parentB := Generate(a).Traits.values(), Generate(b).Traits.values()
+
+	best, bestScore := "", -1
+	for i := range breedAttempts {
+		child := uuid.NewSHA1(breedNamespace, fmt.Appendf(nil, "%s:%s:%d", a, b, i)).String()
+
+		score, perfect := inheritance(Generate(child).Traits.values(), parentA, parentB)
+		if score > bestScore {
+			best, bestScore = child, score
+		}
+		if perfect {
+			break
+		}
+	}
+
+	return best
+}
+
+func inheritance(child, parentA, parentB []string) (int, bool) {
+	score, fromA, fromB, differs := 0, false, false, false
+	for i := range child {
+		if parentA[i] != parentB[i] {
+			differs = true
+		}
+
+		switch child[i] {
+		case parentA[i]:
+			score++
+			fromA = fromA || parentA[i] != parentB[i]
+		case parentB[i]:
+			score++
+			fromB = true
+		}
+	}
+
+	if (fromA && fromB) || !differs {
+		score++
+	}
+
+	return score, score == len(child)+1
+}
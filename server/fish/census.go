@@ -0,0 +1,63 @@
+package fish
+
+import (
+	"math"
+	"strconv"
+)
+
+// Census is distribution of traits between all souls
+type Census struct {
+	Total  int
+	counts map[string]int
+}
+
+type Rarity struct {
+	Probability float64 `json:"probability"`
+	OneIn       int     `json:"one_in"` // not more than math.MaxInt32
+}
+
+func NewCensus(seeds []string) Census {
+	census := Census{
+		Total:  len(seeds),
+		counts: make(map[string]int),
+	}
+
+	for _, seed := range seeds {
+		for _, value := range Generate(seed).Traits.values() {
+			census.counts[value]++
+		}
+	}
+
+	return census
+}
+
+// Rarity multiplies frequency of every trait, so traits treated as independent
+func (c Census) Rarity(traits Traits) Rarity {
+	if c.Total == 0 {
+		return Rarity{1, 1}
+	}
+
+	probability := 1.0
+	for _, value := range traits.values() {
+		// fish not counted yet is at least 1 of total
+		probability *= float64(max(c.counts[value], 1)) / float64(c.Total)
+	}
+
+	// with many traits and souls probability is tiny, 1/probability dont fit in int
+	if probability < 1/float64(math.MaxInt32) {
+		return Rarity{probability, math.MaxInt32}
+	}
+
+	return Rarity{probability, int(math.Round(1 / probability))}
+}
+
+func (t Traits) values() []string {
+	return []string{
+		"body:" + t.Body,
+		"fin:" + t.Fin,
+		"pattern:" + t.Pattern,
+		"color:" + t.Color,
+		"anglerfish:" + strconv.FormatBool(t.Anglerfish),
+		"teeth:" + strconv.FormatBool(t.Teeth),
+	}
+}
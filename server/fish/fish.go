@@ -0,0 +1,200 @@
+package fish
+
+import (
+	"math"
+)
+
+// Pixel values of Fish.Data, same as palette indexes in static/script.js
+const (
+	Empty = iota
+	Primary
+	Secondary
+	Eye
+	Teeth
+	Light
+)
+
+type Fish struct {
+	Data    [][]int
+	Hue     float64
+	Scale   float64
+	Traits  Traits
+	Palette Palette
+}
+
+// seeded random from static/script.js, dont change it or all fishes will mutate
+type random struct {
+	seed int
+}
+
+func (r *random) next() float64 {
+	r.seed = (r.seed*9301 + 49297) % 233280
+	return float64(r.seed) / 233280
+}
+
+func (r *random) intn(n int) int {
+	return int(math.Floor(r.next() * float64(n)))
+}
+
+// Generate is a port of generateRandomFish from static/script.js
+// every step must consume random in the same order as frontend
+func Generate(seed string) Fish {
+	seedValue := 0
+	for _, c := range seed {
+		seedValue += int(c)
+	}
+	r := &random{seedValue}
+
+	var traits Traits
+
+	headHeight := r.intn(4) + 8
+
+	bodyWidth := r.intn(8) + 10
+	body := generateBody(bodyWidth, headHeight)
+	traits.Body = bodyShape(bodyWidth)
+	traits.Pattern = PatternPlain
+	if r.next() > 0.5 {
+		traits.Pattern = addBodyPattern(body, r)
+	}
+
+	head := generateBody(r.intn(2)+6, headHeight)
+	if r.next() > 0.9 {
+		addAnglerfishLight(head)
+		traits.Anglerfish = true
+	}
+
+	// eye
+	head[headHeight/2][len(head[0])-3] = Eye
+
+	if r.next() > 0.8 {
+		traits.Teeth = true
+		for i := range head[0] {
+			if float64(i) > float64(len(head[0]))/2 && r.next() > 0.5 {
+				head[headHeight-2][i] = Teeth
+			}
+		}
+	}
+
+	tailWidth := r.intn(3) + 5
+	tailType := r.intn(10)
+	tail := generateTail(tailWidth, headHeight, tailType)
+	traits.Fin = finType(tailType)
+
+	hue := r.next() * 360
+	traits.Color = colorName(hue)
+
+	return Fish{
+		Data:    combineParts(tail, body, head),
+		Hue:     hue,
+		Scale:   r.next()*0.3 + 0.3,
+		Traits:  traits,
+		Palette: newPalette(hue),
+	}
+}
+
+func newGrid(width, height int) [][]int {
+	grid := make([][]int, height)
+	for y := range grid {
+		grid[y] = make([]int, width)
+	}
+	return grid
+}
+
+func generateBody(width, height int) [][]int {
+	body := newGrid(width, height)
+	a := float64(width) / 2
+	b := float64(height) / 2
+	for y := range height {
+		for x := range width {
+			dx, dy := float64(x)-a, float64(y)-b
+			if dx*dx/(a*a)+dy*dy/(b*b) < 1 {
+				body[y][x] = Primary
+			}
+		}
+	}
+	return body
+}
+
+func generateTail(width, height, tailType int) [][]int {
+	tail := newGrid(width, height)
+	half := float64(height) / 2
+	for y := range height {
+		for x := range width {
+			switch tailType {
+			case 1: // forked
+				if y >= x && y <= height-x && !(float64(y) > half-1 && float64(y) < half+1) {
+					tail[y][x] = Primary
+				}
+			case 2: // flat
+				if float64(y) > half-2 && float64(y) < half+2 {
+					tail[y][x] = Primary
+				}
+			default: // solid triangle
+				if y >= x && y <= height-x {
+					tail[y][x] = Primary
+				}
+			}
+		}
+	}
+	return tail
+}
+
+func addBodyPattern(body [][]int, r *random) string {
+	patternType := r.intn(4)
+	for y := range body {
+		for x := range body[y] {
+			if body[y][x] != Primary {
+				continue
+			}
+			switch patternType {
+			case 0:
+				if r.next() > 0.7 {
+					body[y][x] = Secondary
+				}
+			case 1:
+				if math.Sin(float64(x)*0.5+float64(y)*0.5) > 0.5 {
+					body[y][x] = Secondary
+				}
+			case 2:
+				if y%3 == 0 {
+					body[y][x] = Secondary
+				}
+			case 3:
+				if x%4 == 0 || y%4 == 0 {
+					body[y][x] = Secondary
+				}
+			}
+		}
+	}
+	return patterns[patternType]
+}
+
+func addAnglerfishLight(head [][]int) {
+	lightX := len(head[0]) / 2
+	for y := 0; float64(y) < float64(len(head))/2; y++ {
+		head[y][lightX] = Light // stalk
+	}
+	head[0][lightX] = Empty // tip of stalk
+	head[1][lightX-1] = Light
+	head[1][lightX+1] = Light
+}
+
+func combineParts(tail, body, head [][]int) [][]int {
+	width := len(tail[0]) + len(body[0]) + len(head[0]) - 4
+	data := newGrid(width, len(body))
+
+	offset := 0
+	for _, part := range [][][]int{tail, body, head} {
+		for y := range part {
+			for x := range part[y] {
+				if part[y][x] != Empty {
+					data[y][offset+x] = part[y][x]
+				}
+			}
+		}
+		// next part overlaps previous slightly
+		offset += len(part[0]) - 2
+	}
+
+	return data
+}
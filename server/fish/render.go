@@ -0,0 +1,93 @@
+package fish
+
+import (
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+var (
+	aquariumTop    = color.RGBA{0xe6, 0xf3, 0xff, 0xff} // --background from style.css
+	aquariumBottom = color.RGBA{0x87, 0xce, 0xeb, 0xff} // --secondary from style.css
+)
+
+// Colors returns colors of Fish.Data values, same as _generateProceduralPalette in static/script.js
+func (f Fish) Colors() map[int]color.RGBA {
+	colors := map[int]color.RGBA{
+		Eye:   {0x00, 0x00, 0x00, 0xff},
+		Teeth: {0xff, 0xff, 0xff, 0xff},
+		Light: {0xff, 0xff, 0x00, 0xff},
+	}
+
+	r, g, b := HSLToRGB(f.Hue, 0.7, 0.5)
+	colors[Primary] = color.RGBA{r, g, b, 0xff}
+	r, g, b = HSLToRGB(math.Mod(f.Hue+120, 360), 0.7, 0.6)
+	colors[Secondary] = color.RGBA{r, g, b, 0xff}
+
+	return colors
+}
+
+func (f Fish) Width(pixelSize float64) int {
+	return int(math.Ceil(float64(len(f.Data[0])) * pixelSize))
+}
+
+func (f Fish) Height(pixelSize float64) int {
+	return int(math.Ceil(float64(len(f.Data)) * pixelSize))
+}
+
+// Draw draws fish on img with top left corner at x, y
+func (f Fish) Draw(img draw.Image, x, y int, pixelSize float64) {
+	colors := f.Colors()
+	for row := range f.Data {
+		for col, value := range f.Data[row] {
+			if value == Empty {
+				continue
+			}
+
+			rect := image.Rect(
+				x+int(float64(col)*pixelSize), y+int(float64(row)*pixelSize),
+				x+int(float64(col+1)*pixelSize), y+int(float64(row+1)*pixelSize),
+			)
+			draw.Draw(img, rect, &image.Uniform{colors[value]}, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// Aquarium draws fishes on ocean background. Place of every fish depends only on
+// seed and index, so same seeds always give same picture
+func Aquarium(seeds []string, width, height int, pixelMultiplier float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		t := float64(y) / float64(height)
+		c := color.RGBA{
+			lerp(aquariumTop.R, aquariumBottom.R, t),
+			lerp(aquariumTop.G, aquariumBottom.G, t),
+			lerp(aquariumTop.B, aquariumBottom.B, t),
+			0xff,
+		}
+		draw.Draw(img, image.Rect(0, y, width, y+1), &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+
+	for i, seed := range seeds {
+		f := Generate(seed)
+		pixelSize := pixelMultiplier * f.Scale
+
+		hash := fnv.New64a()
+		hash.Write([]byte(seed))
+		hash.Write([]byte{byte(i)})
+		position := hash.Sum64()
+
+		x := int(position % uint64(max(width-f.Width(pixelSize), 1)))
+		y := int((position >> 32) % uint64(max(height-f.Height(pixelSize), 1)))
+		f.Draw(img, x, y, pixelSize)
+	}
+
+	return img
+}
+
+func lerp(a, b uint8, t float64) uint8 {
+	return uint8(float64(a) + (float64(b)-float64(a))*t)
+}
@@ -0,0 +1,104 @@
+package fish
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	BodyStubby  = "stubby"
+	BodyRegular = "regular"
+	BodyLong    = "long"
+
+	FinTriangle = "triangle"
+	FinForked   = "forked"
+	FinFlat     = "flat"
+
+	PatternPlain    = "plain"
+	PatternSpeckled = "speckled"
+	PatternWavy     = "wavy"
+	PatternStriped  = "striped"
+	PatternGrid     = "grid"
+)
+
+// index is patternType from generator
+var patterns = []string{PatternSpeckled, PatternWavy, PatternStriped, PatternGrid}
+
+type Traits struct {
+	Body       string `json:"body"`
+	Fin        string `json:"fin"`
+	Pattern    string `json:"pattern"`
+	Color      string `json:"color"`
+	Anglerfish bool   `json:"anglerfish"`
+	Teeth      bool   `json:"teeth"`
+}
+
+type Palette struct {
+	Primary   string `json:"primary"`
+	Secondary string `json:"secondary"`
+}
+
+func bodyShape(width int) string {
+	switch {
+	case width <= 12:
+		return BodyStubby
+	case width <= 15:
+		return BodyRegular
+	default:
+		return BodyLong
+	}
+}
+
+func finType(tailType int) string {
+	switch tailType {
+	case 1:
+		return FinForked
+	case 2:
+		return FinFlat
+	default:
+		return FinTriangle
+	}
+}
+
+// hue buckets of 45 degrees
+var colorNames = []string{"red", "orange", "yellow", "green", "cyan", "blue", "purple", "pink"}
+
+func colorName(hue float64) string {
+	return colorNames[int(math.Mod(hue+22.5, 360)/45)%len(colorNames)]
+}
+
+func newPalette(hue float64) Palette {
+	return Palette{
+		Primary:   HSLToHex(hue, 0.7, 0.5),
+		Secondary: HSLToHex(math.Mod(hue+120, 360), 0.7, 0.6),
+	}
+}
+
+func HSLToHex(h, s, l float64) string {
+	r, g, b := HSLToRGB(h, s, l)
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+func HSLToRGB(h, s, l float64) (uint8, uint8, uint8) {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return uint8(math.Round((r + m) * 255)), uint8(math.Round((g + m) * 255)), uint8(math.Round((b + m) * 255))
+}
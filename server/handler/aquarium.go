@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/fish"
+	"tomashevich/server/middleware"
+	"tomashevich/server/utils"
+)
+
+// random mode picks one of few samples, so it renders only few pictures per rotation
+const aquariumSamples = 8
+
+func RegisterAquarium(m *http.ServeMux, db *database.Database, config *utils.AquariumConfig, caches *utils.CacheConfig) {
+	os.MkdirAll(config.CacheDir, os.ModePerm)
+
+	samples := &aquariumSampleCache{
+		ttl:  time.Second * time.Duration(max(caches.Aquarium, 60)),
+		size: config.MaxFishes,
+	}
+
+	getAquarium(m, db, config, caches, samples)
+}
+
+// aquariumSampleCache keeps random sets of fishes, new sets are picked every ttl.
+// Every request of random mode would be new picture to render and store otherwise
+type aquariumSampleCache struct {
+	mu        sync.Mutex
+	samples   [][]string
+	updatedAt time.Time
+	ttl       time.Duration
+	size      int
+}
+
+func (c *aquariumSampleCache) Get(ctx context.Context, db *database.Database) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.updatedAt.IsZero() || time.Since(c.updatedAt) >= c.ttl {
+		samples := make([][]string, 0, aquariumSamples)
+		for range aquariumSamples {
+			seeds, err := db.GetRandomSeeds(ctx, c.size)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, seeds)
+		}
+
+		c.samples = samples
+		c.updatedAt = time.Now()
+	}
+
+	return c.samples[rand.IntN(len(c.samples))], nil
+}
+
+func getAquarium(m *http.ServeMux, db *database.Database, config *utils.AquariumConfig, caches *utils.CacheConfig, samples *aquariumSampleCache) {
+	const path = "GET /fishes/aquarium.png"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		if n <= 0 {
+			n = config.Fishes
+		}
+		n = min(n, config.MaxFishes)
+
+		var seeds []string
+		var err error
+		switch r.URL.Query().Get("mode") {
+		case "", "recent":
+			seeds, err = db.GetRecentSeeds(r.Context(), n)
+		case "random":
+			seeds, err = samples.Get(r.Context(), db)
+			seeds = seeds[:min(n, len(seeds))]
+		default:
+			utils.WriteError(w, "invalid mode", http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, "Failed to get fishes", http.StatusInternalServerError)
+			return
+		}
+
+		file := filepath.Join(config.CacheDir, aquariumKey(seeds, config)+".png")
+		if _, err := os.Stat(file); err != nil {
+			if err := renderAquarium(file, seeds, config); err != nil {
+				log.Printf("cant render aquarium with err %s", err.Error())
+				utils.WriteError(w, "cant draw aquarium", http.StatusInternalServerError)
+				return
+			}
+			pruneAquariumCache(config)
+		}
+
+		middleware.SetCacheRule(w, time.Second*time.Duration(caches.Aquarium))
+		w.Header().Set("Content-Type", "image/png")
+		http.ServeFile(w, r, file)
+	})
+}
+
+// aquariumKey is same for same fishes in same order and same picture settings
+func aquariumKey(seeds []string, config *utils.AquariumConfig) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%dx%d:%g:", config.Width, config.Height, config.PixelMultiplier)
+	hash.Write([]byte(strings.Join(seeds, ",")))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func renderAquarium(file string, seeds []string, config *utils.AquariumConfig) error {
+	img := fish.Aquarium(seeds, config.Width, config.Height, config.PixelMultiplier)
+
+	// write to temp file, so other request never reads half of png
+	tmp, err := os.CreateTemp(config.CacheDir, "aquarium-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// pruneAquariumCache removes oldest pictures when there are more than config.MaxCacheFiles
+func pruneAquariumCache(config *utils.AquariumConfig) {
+	files, err := filepath.Glob(filepath.Join(config.CacheDir, "*.png"))
+	if err != nil || len(files) <= config.MaxCacheFiles {
+		return
+	}
+
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+
+	slices.SortFunc(files, func(a, b string) int {
+		return modTimes[a].Compare(modTimes[b])
+	})
+
+	for _, file := range files[:len(files)-config.MaxCacheFiles] {
+		os.Remove(file)
+	}
+}
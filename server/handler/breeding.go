@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/fish"
+	"tomashevich/server/middleware"
+	"tomashevich/server/utils"
+)
+
+const familyTreeDepth = 5
+
+func RegisterBreeding(m *http.ServeMux, db *database.Database, config *utils.FishesConfig) {
+	breedFish(m, db, config)
+	getFamilyTree(m, db)
+}
+
+type breedFishData struct {
+	Seed string `json:"seed"`
+}
+
+type breedFishResponse struct {
+	Seed    string `json:"seed"`
+	ParentA string `json:"parent_a"`
+	ParentB string `json:"parent_b"`
+}
+
+func breedFish(m *http.ServeMux, db *database.Database, config *utils.FishesConfig) {
+	const path = "POST /fishes:breed"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.GetSoulID(r.Context())
+		if id == 0 {
+			writeNoSoul(w, r)
+			return
+		}
+
+		if middleware.IsDrifter(r.Context()) {
+			utils.WriteError(w, "drifter fish cant breed, come back later", http.StatusForbidden)
+			return
+		}
+
+		var data breedFishData
+		defer r.Body.Close()
+		if err := utils.UnmarshalJSON(r.Body, &data); err != nil {
+			utils.WriteError(w, "invalid form", http.StatusUnprocessableEntity)
+			return
+		}
+
+		seed, err := db.GetSeed(r.Context(), id)
+		if err != nil {
+			utils.WriteError(w, "cant find your soul in fishes", http.StatusInternalServerError)
+			return
+		}
+
+		if data.Seed == seed {
+			utils.WriteError(w, "fish cant breed with itself", http.StatusUnprocessableEntity)
+			return
+		}
+
+		exists, err := db.IsSeedExists(r.Context(), data.Seed)
+		if err != nil {
+			utils.WriteError(w, "cant find fish", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			utils.WriteError(w, "fish not found", http.StatusNotFound)
+			return
+		}
+
+		// same parents give same child, bred child is not counted in limit and not searched again
+		child, err := db.GetChild(r.Context(), seed, data.Seed)
+		if err == nil {
+			utils.WriteJSON(w, breedFishResponse{child, seed, data.Seed}, http.StatusOK)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, "cant breed fishes", http.StatusInternalServerError)
+			return
+		}
+
+		// limit is checked before search of child, its thousands of generated fishes
+		since := time.Now().Add(-time.Second * time.Duration(config.BreedPeriod))
+		err = db.CheckBreedLimit(r.Context(), id, since, config.BreedLimit)
+		if err == nil {
+			child = fish.Breed(seed, data.Seed)
+			err = db.BreedFish(r.Context(), child, seed, data.Seed, id, since, config.BreedLimit)
+		}
+		if errors.Is(err, database.ErrBreedLimit) {
+			utils.WriteError(w, "already bred maximum of fishes", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, "cant breed fishes", http.StatusInternalServerError)
+			return
+		}
+
+		utils.WriteJSON(w, breedFishResponse{child, seed, data.Seed}, http.StatusOK)
+	})
+}
+
+type familyTree struct {
+	Seed    string        `json:"seed"`
+	Parents []*familyTree `json:"parents,omitempty"`
+}
+
+type familyTreeResponse struct {
+	Tree     *familyTree `json:"tree"`
+	Children []string    `json:"children"`
+}
+
+func buildFamilyTree(seed string, lineages map[string]database.Lineage, depth int) *familyTree {
+	tree := &familyTree{Seed: seed}
+
+	lineage, ok := lineages[seed]
+	if !ok || depth >= familyTreeDepth {
+		return tree
+	}
+
+	tree.Parents = []*familyTree{
+		buildFamilyTree(lineage.ParentA, lineages, depth+1),
+		buildFamilyTree(lineage.ParentB, lineages, depth+1),
+	}
+
+	return tree
+}
+
+func getFamilyTree(m *http.ServeMux, db *database.Database) {
+	const path = "GET /fishes/{seed}/family"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		seed := r.PathValue("seed")
+
+		exists, err := db.IsSeedExists(r.Context(), seed)
+		if err != nil {
+			utils.WriteError(w, "cant find fish", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			utils.WriteError(w, "fish not found", http.StatusNotFound)
+			return
+		}
+
+		ancestors, err := db.GetAncestors(r.Context(), seed, familyTreeDepth)
+		if err != nil {
+			utils.WriteError(w, "cant get family of fish", http.StatusInternalServerError)
+			return
+		}
+
+		lineages := make(map[string]database.Lineage, len(ancestors))
+		for _, lineage := range ancestors {
+			lineages[lineage.Seed] = lineage
+		}
+
+		children, err := db.GetChildren(r.Context(), seed)
+		if err != nil {
+			utils.WriteError(w, "cant get family of fish", http.StatusInternalServerError)
+			return
+		}
+
+		utils.WriteJSON(w, familyTreeResponse{buildFamilyTree(seed, lineages, 0), children}, http.StatusOK)
+	})
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/middleware"
+	"tomashevich/server/utils"
+)
+
+func RegisterCatches(m *http.ServeMux, db *database.Database, config *utils.FishesConfig) {
+	catchFish(m, db, config)
+	getCollection(m, db)
+}
+
+func catchFish(m *http.ServeMux, db *database.Database, config *utils.FishesConfig) {
+	// wildcard cant be part of segment, so {seed}:catch is parsed by hand
+	const path = "POST /fishes/{seedAction}"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		seed, ok := strings.CutSuffix(r.PathValue("seedAction"), ":catch")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		id := middleware.GetSoulID(r.Context())
+		if id == 0 {
+			writeNoSoul(w, r)
+			return
+		}
+
+		if middleware.IsDrifter(r.Context()) {
+			utils.WriteError(w, "drifter cant catch fishes, come back later", http.StatusForbidden)
+			return
+		}
+
+		fishSoulID, err := db.GetSoulIDBySeed(r.Context(), seed)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, "fish not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, "cant find fish", http.StatusInternalServerError)
+			return
+		}
+
+		if fishSoulID == id {
+			utils.WriteError(w, "cant catch your own fish", http.StatusUnprocessableEntity)
+			return
+		}
+
+		since := time.Now().Add(-time.Second * time.Duration(config.CatchCooldown))
+		err = db.CatchFish(r.Context(), id, seed, since)
+		if errors.Is(err, database.ErrCatchCooldown) {
+			utils.WriteError(w, "too fast, fishes need rest", http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, "cant catch fish", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type collectionResponse struct {
+	Unique  int              `json:"unique"`
+	Total   int              `json:"total"`
+	Catches []database.Catch `json:"catches"`
+}
+
+func getCollection(m *http.ServeMux, db *database.Database) {
+	const path = "GET /fishes/me/collection"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.GetSoulID(r.Context())
+		if id == 0 {
+			writeNoSoul(w, r)
+			return
+		}
+
+		catches, err := db.GetCollection(r.Context(), id)
+		if err != nil {
+			utils.WriteError(w, "cant get your collection", http.StatusInternalServerError)
+			return
+		}
+
+		total := 0
+		for _, catch := range catches {
+			total += catch.Count
+		}
+
+		utils.WriteJSON(w, collectionResponse{len(catches), total, catches}, http.StatusOK)
+	})
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/middleware"
+	"tomashevich/server/utils"
+)
+
+func RegisterClaims(m *http.ServeMux, db *database.Database, limiter middleware.Middleware, identity *middleware.Identity, cache *middleware.SoulCache, hasher *utils.AddressHasher, config *utils.ServerConfig, identityConfig *utils.IdentityConfig) {
+	exportSoul(m, db, hasher, config)
+	claimSoul(m, db, limiter, identity, cache, hasher, config, identityConfig)
+}
+
+func hashClaimToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+type exportSoulResponse struct {
+	Token string `json:"token"`
+}
+
+func exportSoul(m *http.ServeMux, db *database.Database, hasher *utils.AddressHasher, config *utils.ServerConfig) {
+	const path = "GET /fishes/me:export"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		id := middleware.GetSoulID(r.Context())
+		if id == 0 {
+			writeNoSoul(w, r)
+			return
+		}
+
+		if middleware.IsDrifter(r.Context()) {
+			utils.WriteError(w, "drifter soul cant be exported", http.StatusForbidden)
+			return
+		}
+
+		// new token every export, previous one is revoked
+		token := rand.Text()
+		if err := db.SetClaimToken(r.Context(), id, hashClaimToken(token)); err != nil {
+			utils.WriteError(w, "cant export your soul", http.StatusInternalServerError)
+			return
+		}
+
+		ip := hasher.Hash(utils.GetIPAddr(r, config))
+		if err := db.WriteAudit(r.Context(), id, database.AuditSoulExport, ip, true); err != nil {
+			log.Printf("cant write audit of soul %d export with err %s", id, err.Error())
+		}
+
+		utils.WriteJSON(w, exportSoulResponse{token}, http.StatusOK)
+	})
+}
+
+type claimSoulData struct {
+	Token string `json:"token"`
+}
+
+func claimSoul(m *http.ServeMux, db *database.Database, limiter middleware.Middleware, identity *middleware.Identity, cache *middleware.SoulCache, hasher *utils.AddressHasher, config *utils.ServerConfig, identityConfig *utils.IdentityConfig) {
+	const path = "POST /fishes/me:claim"
+	m.Handle(path, limiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// visitor without soul dont get new one just to replace it by claimed one
+		id := middleware.FindSoulID(r.Context())
+		ip := hasher.Hash(utils.GetIPAddr(r, config))
+
+		var data claimSoulData
+		defer r.Body.Close()
+		if err := utils.UnmarshalJSON(r.Body, &data); err != nil || data.Token == "" {
+			utils.WriteError(w, "invalid form", http.StatusUnprocessableEntity)
+			return
+		}
+
+		since := time.Now().Add(-time.Second * time.Duration(identityConfig.ClaimTokenTTL))
+		claimedID, err := db.ClaimSoul(r.Context(), hashClaimToken(data.Token), since, id, hasher.Hash(utils.GetAddr(r, config)))
+		if errors.Is(err, database.ErrClaimTokenInvalid) {
+			if err := db.WriteAudit(r.Context(), id, database.AuditSoulClaim, ip, false); err != nil {
+				log.Printf("cant write audit of failed claim from %s with err %s", ip, err.Error())
+			}
+			utils.WriteError(w, "invalid token", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, "cant claim soul", http.StatusInternalServerError)
+			return
+		}
+
+		if claimedID != id {
+			// address of both souls is changed, without cookies cache would give old soul to this address
+			cache.Forget(claimedID)
+			cache.Forget(id)
+			identity.SetCookie(w, claimedID)
+		}
+
+		if err := db.WriteAudit(r.Context(), claimedID, database.AuditSoulClaim, ip, true); err != nil {
+			log.Printf("cant write audit of soul %d claim with err %s", claimedID, err.Error())
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})))
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/middleware"
+	"tomashevich/server/utils"
+)
+
+func RegisterDaily(m *http.ServeMux, db *database.Database) {
+	getDailyFish(m, db)
+	getDailyHistory(m, db)
+}
+
+func getDailyFish(m *http.ServeMux, db *database.Database) {
+	const path = "GET /fishes/daily"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UTC()
+		day := now.Format(time.DateOnly)
+
+		seed, err := db.GetDailyFish(r.Context(), day)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, "no fishes in ocean", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, "cant get fish of day", http.StatusInternalServerError)
+			return
+		}
+
+		tomorrow := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		middleware.SetCacheRule(w, tomorrow.Sub(now)) // until next fish
+
+		utils.WriteJSON(w, database.DailyFish{Day: day, Seed: seed}, http.StatusOK)
+	})
+}
+
+type dailyHistoryResponse struct {
+	History []database.DailyFish `json:"history"`
+}
+
+func getDailyHistory(m *http.ServeMux, db *database.Database) {
+	const path = "GET /fishes/daily/history"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		pageQuery := r.URL.Query().Get("page")
+		page, _ := strconv.ParseInt(pageQuery, 10, 32)
+		if page <= 0 {
+			page = 1
+		}
+		page -= 1
+
+		history, err := db.GetDailyHistory(r.Context(), 100, page*100)
+		if err != nil {
+			utils.WriteError(w, "cant get history of daily fishes", http.StatusInternalServerError)
+			return
+		}
+
+		utils.WriteJSON(w, dailyHistoryResponse{history}, http.StatusOK)
+	})
+}
@@ -1,17 +1,58 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"tomashevich/server/database"
+	"tomashevich/server/fish"
 	"tomashevich/server/middleware"
 	"tomashevich/server/utils"
+
+	"github.com/google/uuid"
 )
 
-func RegisterFishes(m *http.ServeMux, db *database.Database, config *utils.CacheConfig) {
+func RegisterFishes(m *http.ServeMux, db *database.Database, config *utils.CacheConfig, fishesConfig *utils.FishesConfig) {
+	census := &censusCache{ttl: time.Second * time.Duration(config.FishCensus)}
+
 	listFishes(m, db)
-	getFish(m, db, config)
+	randomFishes(m, db)
+	searchFishes(m, db)
+	getFish(m, db)
+	rerollFish(m, db, fishesConfig)
+	getMyFishTraits(m, db, census)
+	getFishTraits(m, db, census)
+}
+
+// censusCache recounts traits of all souls not often than ttl
+type censusCache struct {
+	mu        sync.Mutex
+	census    fish.Census
+	updatedAt time.Time
+	ttl       time.Duration
+}
+
+func (c *censusCache) Get(ctx context.Context, db *database.Database) (fish.Census, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.updatedAt.IsZero() && time.Since(c.updatedAt) < c.ttl {
+		return c.census, nil
+	}
+
+	seeds, err := db.GetAllSeeds(ctx)
+	if err != nil {
+		return c.census, err
+	}
+
+	c.census = fish.NewCensus(seeds)
+	c.updatedAt = time.Now()
+
+	return c.census, nil
 }
 
 type listFishesResponse struct {
@@ -42,18 +83,63 @@ func listFishes(m *http.ServeMux, db *database.Database) {
 	})
 }
 
+func randomFishes(m *http.ServeMux, db *database.Database) {
+	const path = "GET /fishes:random"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		if n <= 0 {
+			n = 10
+		}
+		n = min(n, 100)
+
+		seeds, err := db.GetRandomSeeds(r.Context(), n)
+		if err != nil {
+			utils.WriteError(w, "Failed to get fishes", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		utils.WriteJSON(w, listFishesResponse{seeds}, http.StatusOK)
+	})
+}
+
+// for now only seed prefix, names will be searched here too
+func searchFishes(m *http.ServeMux, db *database.Database) {
+	const path = "GET /fishes:search"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+		if q == "" {
+			utils.WriteError(w, "empty query", http.StatusUnprocessableEntity)
+			return
+		}
+
+		pageQuery := r.URL.Query().Get("page")
+		page, _ := strconv.ParseInt(pageQuery, 10, 32)
+		if page <= 0 {
+			page = 1
+		}
+		page -= 1
+
+		seeds, err := db.SearchSeeds(r.Context(), q, 100, page*100)
+		if err != nil {
+			utils.WriteError(w, "Failed to search fishes", http.StatusInternalServerError)
+			return
+		}
+
+		utils.WriteJSON(w, listFishesResponse{seeds}, http.StatusOK)
+	})
+}
+
 type getFishResponse struct {
 	Seed string `json:"seed"`
 }
 
-func getFish(m *http.ServeMux, db *database.Database, config *utils.CacheConfig) {
+func getFish(m *http.ServeMux, db *database.Database) {
 	const path = "GET /fishes/me"
 	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		middleware.SetCacheRule(w, time.Second*time.Duration(config.FishesMe)) // week
-
 		id := middleware.GetSoulID(r.Context())
 		if id == 0 {
-			utils.WriteError(w, "cant get your soul", http.StatusInternalServerError)
+			writeNoSoul(w, r)
 			return
 		}
 
@@ -63,6 +149,107 @@ func getFish(m *http.ServeMux, db *database.Database, config *utils.CacheConfig)
 			return
 		}
 
+		// seed changes on reroll, so browser asks every time and gets 304 while its same
+		if middleware.SetRevalidateCacheRule(w, r, seed) {
+			return
+		}
+
 		utils.WriteJSON(w, getFishResponse{seed}, http.StatusOK)
 	})
 }
+
+type rerollFishResponse struct {
+	Seed          string `json:"seed"`
+	RerollsRemain int    `json:"rerolls_remain"`
+}
+
+func rerollFish(m *http.ServeMux, db *database.Database, config *utils.FishesConfig) {
+	const path = "POST /fishes/me:reroll"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.GetSoulID(r.Context())
+		if id == 0 {
+			writeNoSoul(w, r)
+			return
+		}
+
+		if middleware.IsDrifter(r.Context()) {
+			utils.WriteError(w, "drifter fish cant be rerolled", http.StatusForbidden)
+			return
+		}
+
+		uuid, err := uuid.NewV7()
+		if err != nil {
+			utils.WriteError(w, "cant make new seed", http.StatusInternalServerError)
+			return
+		}
+
+		since := time.Now().Add(-time.Second * time.Duration(config.RerollPeriod))
+		remain, err := db.RerollSeed(r.Context(), id, uuid.String(), since, config.RerollLimit)
+		if errors.Is(err, database.ErrRerollLimit) {
+			utils.WriteError(w, "already rerolled maximum of times", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, "cant reroll your fish", http.StatusInternalServerError)
+			return
+		}
+
+		utils.WriteJSON(w, rerollFishResponse{uuid.String(), remain}, http.StatusOK)
+	})
+}
+
+type fishTraitsResponse struct {
+	Seed    string       `json:"seed"`
+	Traits  fish.Traits  `json:"traits"`
+	Palette fish.Palette `json:"palette"`
+	Rarity  fish.Rarity  `json:"rarity"`
+}
+
+func writeFishTraits(w http.ResponseWriter, r *http.Request, db *database.Database, census *censusCache, seed string) {
+	c, err := census.Get(r.Context(), db)
+	if err != nil {
+		utils.WriteError(w, "cant count fishes", http.StatusInternalServerError)
+		return
+	}
+
+	f := fish.Generate(seed)
+	utils.WriteJSON(w, fishTraitsResponse{seed, f.Traits, f.Palette, c.Rarity(f.Traits)}, http.StatusOK)
+}
+
+func getMyFishTraits(m *http.ServeMux, db *database.Database, census *censusCache) {
+	const path = "GET /fishes/me/traits"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.GetSoulID(r.Context())
+		if id == 0 {
+			writeNoSoul(w, r)
+			return
+		}
+
+		seed, err := db.GetSeed(r.Context(), id)
+		if err != nil {
+			utils.WriteError(w, "cant find your soul in fishes", http.StatusInternalServerError)
+			return
+		}
+
+		writeFishTraits(w, r, db, census, seed)
+	})
+}
+
+func getFishTraits(m *http.ServeMux, db *database.Database, census *censusCache) {
+	const path = "GET /fishes/{seed}/traits"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		seed := r.PathValue("seed")
+
+		exists, err := db.IsSeedExists(r.Context(), seed)
+		if err != nil {
+			utils.WriteError(w, "cant find fish", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			utils.WriteError(w, "fish not found", http.StatusNotFound)
+			return
+		}
+
+		writeFishTraits(w, r, db, census, seed)
+	})
+}
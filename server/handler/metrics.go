@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net/http"
+	"tomashevich/server/middleware"
+	"tomashevich/server/utils"
+)
+
+func RegisterMetrics(m *http.ServeMux, sybil *middleware.Sybil) {
+	getMetrics(m, sybil)
+}
+
+// only for allowlist (`allow` command), like prometheus on same host
+func getMetrics(m *http.ServeMux, sybil *middleware.Sybil) {
+	const path = "GET /metrics"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if !middleware.IsAllowed(r.Context()) {
+			utils.WriteError(w, "metrics are only for allowlist", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Header().Set("Cache-Control", "no-store")
+		sybil.WriteMetrics(w)
+	})
+}
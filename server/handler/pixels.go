@@ -8,9 +8,10 @@ import (
 	"tomashevich/server/utils"
 )
 
-func RegisterPixels(m *http.ServeMux, db *database.Database, config *utils.CacheConfig) {
+func RegisterPixels(m *http.ServeMux, db *database.Database, config *utils.CacheConfig, pow *middleware.ProofOfWork) {
 	listPixels(m, db)
-	paintPixel(m, db, config)
+	getChallenge(m, db, pow)
+	paintPixel(m, db, config, pow)
 	registerPixels(m, db)
 }
 
@@ -60,18 +61,73 @@ func listPixels(m *http.ServeMux, db *database.Database) {
 	})
 }
 
+type challengeResponse struct {
+	Challenge  string `json:"challenge"` // empty => paint without proof of work
+	Difficulty int    `json:"difficulty"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+func getChallenge(m *http.ServeMux, db *database.Database, pow *middleware.ProofOfWork) {
+	const path = "GET /pixels:challenge"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		if !pow.Enabled() {
+			utils.WriteJSON(w, challengeResponse{}, http.StatusOK)
+			return
+		}
+
+		id := middleware.GetSoulID(r.Context())
+		if id == 0 {
+			writeNoSoul(w, r)
+			return
+		}
+
+		soul, err := db.GetSoul(r.Context(), id)
+		if err != nil {
+			utils.WriteError(w, "cant get your soul", http.StatusInternalServerError)
+			return
+		}
+
+		// dont give work which cant be used
+		if middleware.IsDrifter(r.Context()) {
+			utils.WriteError(w, "drifter cant paint, come back later", http.StatusForbidden)
+			return
+		}
+
+		if soul.PaintedPixels >= 10 {
+			utils.WriteError(w, "already painted maximum of pixels", http.StatusForbidden)
+			return
+		}
+
+		difficulty := pow.Difficulty(r, soul)
+		challenge, expires := pow.Challenge(soul.Id, difficulty)
+
+		utils.WriteJSON(w, challengeResponse{challenge, difficulty, expires.Unix()}, http.StatusOK)
+	})
+}
+
 type paintPixelData struct {
 	X     int    `json:"x"`
 	Y     int    `json:"y"`
 	Color string `json:"color"`
+
+	// from GET /pixels:challenge, if proof of work is enabled
+	Challenge string `json:"challenge"`
+	Nonce     string `json:"nonce"`
 }
 
-func paintPixel(m *http.ServeMux, db *database.Database, config *utils.CacheConfig) {
+func paintPixel(m *http.ServeMux, db *database.Database, config *utils.CacheConfig, pow *middleware.ProofOfWork) {
 	const path = "POST /pixels:paint"
 	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 		id := middleware.GetSoulID(r.Context())
 		if id == 0 {
-			utils.WriteError(w, "cant get your soul", http.StatusInternalServerError)
+			writeNoSoul(w, r)
+			return
+		}
+
+		if middleware.IsDrifter(r.Context()) {
+			utils.WriteError(w, "drifter cant paint, come back later", http.StatusForbidden)
 			return
 		}
 
@@ -100,12 +156,22 @@ func paintPixel(m *http.ServeMux, db *database.Database, config *utils.CacheConf
 		}
 
 		if soul.PaintedPixels >= 10 {
-			middleware.SetCacheRule(w, time.Second*time.Duration(config.PixelsLimit)) // dont send again pls
+			middleware.SetPrivateCacheRule(w, time.Second*time.Duration(config.PixelsLimit)) // dont send again pls
 			utils.WriteError(w, "already painted maximum of pixels", http.StatusForbidden)
 			return
 		}
 
+		if pow.Enabled() {
+			if err := pow.Verify(data.Challenge, data.Nonce, soul.Id); err != nil {
+				utils.WriteError(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
 		if err := db.PaintPixel(r.Context(), soul.Id, data.X, data.Y, color); err != nil {
+			if pow.Enabled() {
+				pow.Release(data.Challenge)
+			}
 			utils.WriteError(w, "cant paint this pixel", http.StatusInternalServerError)
 			return
 		}
@@ -123,7 +189,12 @@ func registerPixels(m *http.ServeMux, db *database.Database) {
 	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 		id := middleware.GetSoulID(r.Context())
 		if id == 0 {
-			utils.WriteError(w, "cant get your soul", http.StatusInternalServerError)
+			writeNoSoul(w, r)
+			return
+		}
+
+		if middleware.IsDrifter(r.Context()) {
+			utils.WriteError(w, "drifter cant register pixels, come back later", http.StatusForbidden)
 			return
 		}
 
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"tomashevich/server/database"
+	"tomashevich/server/middleware"
+	"tomashevich/server/utils"
+)
+
+func RegisterSouls(m *http.ServeMux, db *database.Database, identity *middleware.Identity, cache *middleware.SoulCache, activity *middleware.Activity) {
+	getSoul(m, db, activity)
+	eraseSoul(m, db, identity, cache)
+}
+
+// writeNoSoul answers request which got no soul: crawlers dont get souls, otherwise database failed
+func writeNoSoul(w http.ResponseWriter, r *http.Request) {
+	if utils.IsBot(r.UserAgent()) {
+		utils.WriteError(w, "crawlers dont get souls", http.StatusForbidden)
+		return
+	}
+	utils.WriteError(w, "cant get your soul", http.StatusInternalServerError)
+}
+
+func getSoul(m *http.ServeMux, db *database.Database, activity *middleware.Activity) {
+	const path = "GET /souls/me"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		id := middleware.GetSoulID(r.Context())
+		if id == 0 {
+			writeNoSoul(w, r)
+			return
+		}
+
+		soul, err := db.GetSoul(r.Context(), id)
+		if err != nil {
+			utils.WriteError(w, "cant get your soul", http.StatusInternalServerError)
+			return
+		}
+
+		activity.Current(&soul)
+		utils.WriteJSON(w, soul, http.StatusOK)
+	})
+}
+
+func eraseSoul(m *http.ServeMux, db *database.Database, identity *middleware.Identity, cache *middleware.SoulCache) {
+	const path = "DELETE /souls/me"
+	m.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		// visitor without soul dont get new one just to erase it
+		id := middleware.FindSoulID(r.Context())
+		if id == 0 {
+			identity.ClearCookie(w)
+			utils.WriteError(w, "you have no soul", http.StatusNotFound)
+			return
+		}
+
+		err := db.EraseSoul(r.Context(), id)
+		if errors.Is(err, database.ErrDrifter) {
+			utils.WriteError(w, "drifter soul cant be erased", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, "cant erase your soul", http.StatusInternalServerError)
+			return
+		}
+
+		cache.Forget(id)
+		identity.ClearCookie(w)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/utils"
+)
+
+// Activity collects souls seen by helheim and writes them to database in batches,
+// so api calls dont write on every request
+type Activity struct {
+	db       *database.Database
+	interval time.Duration
+	gap      time.Duration
+
+	mu   sync.Mutex
+	seen map[int]*database.SoulActivity
+}
+
+func NewActivity(db *database.Database, config *utils.IdentityConfig) *Activity {
+	return &Activity{
+		db:       db,
+		interval: time.Duration(max(config.ActivityInterval, 1)) * time.Second,
+		gap:      time.Duration(config.VisitGap) * time.Second,
+		seen:     make(map[int]*database.SoulActivity),
+	}
+}
+
+func (a *Activity) Seen(id int) {
+	now := time.Now().Unix()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.seen[id]
+	if !ok {
+		a.seen[id] = &database.SoulActivity{SoulID: id, FirstSeen: now, LastSeen: now}
+		return
+	}
+
+	if now-s.LastSeen > int64(a.gap.Seconds()) {
+		s.Visits++
+	}
+	s.LastSeen = now
+}
+
+// Current adds activity which is not written yet
+func (a *Activity) Current(soul *database.Soul) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.seen[soul.Id]
+	if !ok {
+		return
+	}
+
+	if soul.LastSeenAt == 0 || s.FirstSeen-soul.LastSeenAt > int64(a.gap.Seconds()) {
+		soul.Visits++
+	}
+	soul.Visits += s.Visits
+	soul.LastSeenAt = max(soul.LastSeenAt, s.LastSeen)
+}
+
+func (a *Activity) Flush() {
+	a.mu.Lock()
+	seen := a.seen
+	a.seen = make(map[int]*database.SoulActivity)
+	a.mu.Unlock()
+
+	if len(seen) == 0 {
+		return
+	}
+
+	activity := make([]database.SoulActivity, 0, len(seen))
+	for _, s := range seen {
+		activity = append(activity, *s)
+	}
+
+	if err := a.db.SaveActivity(context.Background(), activity, int64(a.gap.Seconds())); err != nil {
+		log.Printf("cant save activity of %d souls: %v", len(activity), err)
+	}
+}
+
+// Run writes activity every interval until ctx is done, last activity is written before return
+func (a *Activity) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.Flush()
+			return
+		case <-ticker.C:
+			a.Flush()
+		}
+	}
+}
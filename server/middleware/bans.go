@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/utils"
+)
+
+const allowedKey contextKey = "allowed"
+
+// ParseBanTarget checks ip, cidr or soul:<id> and returns it in form stored in bans
+func ParseBanTarget(target string) (string, error) {
+	if id, ok := strings.CutPrefix(target, "soul:"); ok {
+		if n, err := strconv.Atoi(id); err != nil || n <= 0 {
+			return "", fmt.Errorf("invalid soul id %q", id)
+		}
+		return target, nil
+	}
+
+	if addr, err := netip.ParseAddr(target); err == nil {
+		addr = addr.Unmap().WithZone("")
+		return netip.PrefixFrom(addr, addr.BitLen()).String(), nil
+	}
+
+	prefix, err := netip.ParsePrefix(target)
+	if err != nil {
+		return "", fmt.Errorf("%q is not ip, cidr or soul:<id>", target)
+	}
+	return prefix.Masked().String(), nil
+}
+
+type banRule struct {
+	database.Ban
+	prefix  netip.Prefix
+	soul    int
+	expires time.Time // zero => never
+}
+
+func (rule *banRule) match(addr netip.Addr, soul int, now time.Time) bool {
+	if !rule.expires.IsZero() && !now.Before(rule.expires) {
+		return false
+	}
+	if rule.soul != 0 {
+		return soul == rule.soul
+	}
+	return rule.prefix.Contains(addr)
+}
+
+// BanList keeps bans and allows from database in memory, they are reloaded every interval
+// so commands work without restart
+type BanList struct {
+	db       *database.Database
+	interval time.Duration
+
+	mu     sync.RWMutex
+	bans   []banRule
+	allows []banRule
+}
+
+func NewBanList(db *database.Database, config *utils.BansConfig) *BanList {
+	return &BanList{
+		db:       db,
+		interval: time.Duration(max(config.ReloadInterval, 1)) * time.Second,
+	}
+}
+
+func (b *BanList) Load(ctx context.Context) error {
+	entries, err := b.db.GetBans(ctx)
+	if err != nil {
+		return err
+	}
+
+	var bans, allows []banRule
+	for _, entry := range entries {
+		rule := banRule{Ban: entry}
+		if entry.ExpiresAt != 0 {
+			rule.expires = time.Unix(entry.ExpiresAt, 0)
+		}
+
+		if id, ok := strings.CutPrefix(entry.Target, "soul:"); ok {
+			rule.soul, _ = strconv.Atoi(id)
+		} else if rule.prefix, err = netip.ParsePrefix(entry.Target); err != nil {
+			log.Printf("skip ban %d with invalid target %q", entry.Id, entry.Target)
+			continue
+		}
+
+		if entry.Allow {
+			allows = append(allows, rule)
+		} else {
+			bans = append(bans, rule)
+		}
+	}
+
+	b.mu.Lock()
+	b.bans, b.allows = bans, allows
+	b.mu.Unlock()
+	return nil
+}
+
+// Run reloads list every interval until ctx is done
+func (b *BanList) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.Load(ctx); err != nil {
+				log.Printf("cant reload bans: %v", err)
+			}
+		}
+	}
+}
+
+func findRule(rules []banRule, addr netip.Addr, soul int, now time.Time) *banRule {
+	for i := range rules {
+		if rules[i].match(addr, soul, now) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// Middleware goes before helheim, so banned clients dont get souls. Soul is checked by signed cookie.
+// Allowed clients skip bans and rate limits
+func (b *BanList) Middleware(identity *Identity, config *utils.ServerConfig) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, _ := netip.ParseAddr(utils.GetIPAddr(r, config))
+			soul := identity.SoulID(r)
+			now := time.Now()
+
+			b.mu.RLock()
+			allowed := findRule(b.allows, addr, soul, now) != nil
+			var ban *banRule
+			if !allowed {
+				ban = findRule(b.bans, addr, soul, now)
+			}
+			b.mu.RUnlock()
+
+			if allowed {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), allowedKey, true)))
+				return
+			}
+
+			if ban != nil {
+				if !ban.expires.IsZero() {
+					w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(ban.expires.Sub(now))))
+				}
+				utils.WriteError(w, "you are banned", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsAllowed is true for clients from allowlist
+func IsAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(allowedKey).(bool)
+	return allowed
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -19,3 +20,22 @@ func Cache(duration time.Duration) func(next http.Handler) http.Handler {
 func SetCacheRule(w http.ResponseWriter, duration time.Duration) {
 	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int64(duration.Seconds())))
 }
+
+// SetPrivateCacheRule for responses which depend on soul, shared caches must not store them
+func SetPrivateCacheRule(w http.ResponseWriter, duration time.Duration) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int64(duration.Seconds())))
+}
+
+// SetRevalidateCacheRule for responses which depend on soul and can change any time:
+// browser keeps them, but asks every time. Returns true if 304 is written (client has same etag)
+func SetRevalidateCacheRule(w http.ResponseWriter, r *http.Request, etag string) bool {
+	etag = strconv.Quote(etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -3,6 +3,8 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strconv"
+	"sync"
 	"tomashevich/server/database"
 	"tomashevich/server/utils"
 
@@ -13,33 +15,244 @@ type contextKey string
 
 const souldIdKey contextKey = "soulId"
 
-func Helheim(db *database.Database, isBehindProxy bool) func(next http.Handler) http.Handler {
+// soul is found (or made) only when handler asks GetSoulID, so static files,
+// favicon and robots.txt dont touch database and dont make souls
+type soul struct {
+	db       *database.Database
+	identity *Identity
+	hasher   *utils.AddressHasher
+	cache    *SoulCache
+	activity *Activity
+	sybil    *Sybil
+	config   *utils.ServerConfig
+	w        http.ResponseWriter
+	r        *http.Request
+
+	once    sync.Once
+	id      int
+	created bool
+	drifter bool
+}
+
+func Helheim(db *database.Database, identity *Identity, hasher *utils.AddressHasher, cache *SoulCache, activity *Activity, sybil *Sybil, config *utils.ServerConfig) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := utils.GetIPAddr(r, isBehindProxy)
-			var id int
-			if id, _ = db.GetSoulIDByIP(r.Context(), ip); id == 0 {
-				uuid, err := uuid.NewV7()
-				if err != nil {
-					next.ServeHTTP(w, r)
-					return
-				}
-
-				if id, err = db.GiveSoulToHel(r.Context(), uuid.String(), ip); err != nil {
-					next.ServeHTTP(w, r)
-					return
-				}
-			}
+			s := &soul{db: db, identity: identity, hasher: hasher, cache: cache, activity: activity, sybil: sybil, config: config, r: r}
+			sw := &soulResponseWriter{ResponseWriter: w, soul: s}
+			s.w = sw
+
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), souldIdKey, s)))
 
-			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), souldIdKey, id)))
+			// failed request dont get soul, cache must not give deleted soul to next request
+			if s.created && sw.status >= http.StatusBadRequest {
+				db.DeleteNewSoul(context.Background(), s.id)
+				cache.Forget(s.id)
+			}
 		})
 	}
 }
 
+func (s *soul) get() int {
+	s.once.Do(func() {
+		s.id, s.created = s.resolve(s.r.Context())
+		if s.id != 0 {
+			s.activity.Seen(s.id)
+		}
+	})
+	return s.id
+}
+
+func (s *soul) resolve(ctx context.Context) (int, bool) {
+	if id := s.identity.SoulID(s.r); id != 0 {
+		if s.fromCookie(ctx, id) {
+			return id, false
+		}
+	}
+
+	// address is stored only as hash
+	address := utils.GetAddr(s.r, s.config)
+	ip := s.hasher.Hash(address)
+
+	// without cookies soul is same for whole address
+	if !s.identity.Enabled() {
+		if id, ok := s.cache.souls.Get("address:" + ip); ok {
+			return id, false
+		}
+	}
+
+	bot := utils.IsBot(s.r.UserAgent())
+	key := ip
+	if bot {
+		key += ":bot"
+	}
+
+	// result is shared with other requests, so lookup is not cancelled with this one
+	flightCtx := context.WithoutCancel(ctx)
+	id, created, shared := s.cache.flight.Do(key, func() (int, bool) {
+		return s.fromAddress(flightCtx, address, ip, bot)
+	})
+	if id == 0 {
+		return 0, false
+	}
+
+	// drifter gets no cookie and is not cached, so visitor gets own soul when cap is over
+	if id == s.sybil.Drifter() {
+		s.drifter = true
+		return id, false
+	}
+
+	if !s.identity.Enabled() {
+		s.cache.souls.Add("address:"+ip, id)
+	}
+
+	s.identity.SetCookie(s.w, id)
+
+	// request which made soul can remove it if it fails, but not if other requests got it too
+	return id, created && !shared
+}
+
+// fromCookie checks that soul from cookie still exists
+func (s *soul) fromCookie(ctx context.Context, id int) bool {
+	key := "cookie:" + strconv.Itoa(id)
+	if _, ok := s.cache.souls.Get(key); ok {
+		return true
+	}
+
+	used, bound, err := s.db.GetSoulFlags(ctx, id)
+	if err != nil {
+		return false
+	}
+
+	if !used {
+		s.db.MarkSoulUsedAPI(ctx, id)
+	}
+
+	// cookie came back, soul is not given to other visitors of address anymore
+	if !bound {
+		s.db.BindSoul(ctx, id)
+	}
+
+	s.cache.souls.Add(key, id)
+	return true
+}
+
+func (s *soul) fromAddress(ctx context.Context, address, ip string, bot bool) (int, bool) {
+	id := s.findIPSoul(ctx, ip)
+	if id == 0 {
+		// soul of old address key is moved to current key only when its not found by current one
+		if moved, _ := s.db.RehashAddress(ctx, s.hasher.PreviousHashes(address), ip); moved {
+			id = s.findIPSoul(ctx, ip)
+		}
+	}
+
+	if id != 0 {
+		s.db.MarkSoulUsedAPI(ctx, id)
+		return id, false
+	}
+
+	if bot {
+		return 0, false
+	}
+
+	if !s.sybil.AllowNewSoul(s.r) {
+		return s.sybil.Drifter(), false
+	}
+
+	uuid, err := uuid.NewV7()
+	if err != nil {
+		return 0, false
+	}
+
+	id, err = s.db.GiveSoulToHel(ctx, uuid.String(), ip)
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// findIPSoul for request without cookie. Soul of ip whose cookie never came back is given again,
+// so client which drops cookie dont get new soul (and pixels) on every request.
+// Everyone else behind same ip gets new soul after cookie of previous one came back
+func (s *soul) findIPSoul(ctx context.Context, ip string) int {
+	if !s.identity.Enabled() {
+		id, _ := s.db.GetSoulIDByIP(ctx, ip)
+		return id
+	}
+
+	id, _ := s.db.GetUnboundSoulIDByIP(ctx, ip)
+	return id
+}
+
+type soulResponseWriter struct {
+	http.ResponseWriter
+	soul   *soul
+	status int
+}
+
+func (w *soulResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+		if w.soul.created && code >= http.StatusBadRequest {
+			w.Header().Del("Set-Cookie")
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *soulResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// GetSoulID returns soul of request, makes new one if its first visit.
+// Call it before writing response, soul cookie is set in headers
 func GetSoulID(ctx context.Context) int {
-	id, ok := ctx.Value(souldIdKey).(int)
+	s, ok := ctx.Value(souldIdKey).(*soul)
+	if !ok {
+		return 0
+	}
+	return s.get()
+}
+
+// FindSoulID returns soul of request only if it exists, it never makes soul
+// (for requests which make no sense without soul, like erasing it)
+func FindSoulID(ctx context.Context) int {
+	s, ok := ctx.Value(souldIdKey).(*soul)
 	if !ok {
 		return 0
 	}
+
+	if s.identity.Enabled() {
+		if id := s.identity.SoulID(s.r); id != 0 && s.fromCookie(ctx, id) {
+			return id
+		}
+		return 0
+	}
+
+	id, _ := s.db.GetSoulIDByIP(ctx, s.hasher.Hash(utils.GetAddr(s.r, s.config)))
 	return id
 }
+
+// PeekSoulID returns soul from signed cookie of request, it never asks database and never makes soul.
+// Soul can be erased already, so use it only as key (rate limits)
+func PeekSoulID(ctx context.Context) int {
+	s, ok := ctx.Value(souldIdKey).(*soul)
+	if !ok {
+		return 0
+	}
+
+	return s.identity.SoulID(s.r)
+}
+
+// IsDrifter is true if request got shared drifter soul, it cant paint or change the soul
+func IsDrifter(ctx context.Context) bool {
+	s, ok := ctx.Value(souldIdKey).(*soul)
+	if !ok {
+		return false
+	}
+	s.get()
+	return s.drifter
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"tomashevich/server/database"
+	"tomashevich/server/utils"
+)
+
+func newTestHelheim(t *testing.T, identityConfig *utils.IdentityConfig) (*database.Database, func(next http.Handler) http.Handler) {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "storage.db"), database.MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &utils.ServerConfig{IPv4Prefix: 32, IPv6Prefix: 64}
+	sybil, err := NewSybil(ctx, db, &utils.SybilConfig{}, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity := NewIdentity(identityConfig)
+	return db, Helheim(db, identity, utils.NewAddressHasher(nil), NewSoulCache(identityConfig), NewActivity(db, identityConfig), sybil, server)
+}
+
+func newTestRequest(cookies ...*http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/souls/me", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", "Mozilla/5.0 Firefox")
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+// TestHelheimFailedFirstRequest checks that soul deleted after failed first request
+// is not given to next request of same address from cache
+func TestHelheimFailedFirstRequest(t *testing.T) {
+	// without cookie key souls are identified by address, so they are cached by address
+	db, helheim := newTestHelheim(t, &utils.IdentityConfig{CacheSize: 100, CacheTTL: 300})
+
+	var fail bool
+	handler := helheim(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := GetSoulID(r.Context())
+		if id == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if fail {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		if _, err := db.GetSoul(r.Context(), id); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newTestRequest())
+		return w.Code
+	}
+
+	fail = true
+	if code := request(); code != http.StatusUnprocessableEntity {
+		t.Fatalf("first request status %d", code)
+	}
+
+	fail = false
+	if code := request(); code != http.StatusNoContent {
+		t.Fatalf("second request status %d, want %d", code, http.StatusNoContent)
+	}
+}
+
+// TestHelheimWithoutCookie checks that client which never sends cookie back keeps one soul,
+// and other visitor of same ip gets own soul after cookie of first one came back
+func TestHelheimWithoutCookie(t *testing.T) {
+	_, helheim := newTestHelheim(t, &utils.IdentityConfig{CookieKey: "test", CacheSize: 100, CacheTTL: 300})
+
+	handler := helheim(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strconv.Itoa(GetSoulID(r.Context()))))
+	}))
+
+	request := func(cookies ...*http.Cookie) (int, []*http.Cookie) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newTestRequest(cookies...))
+		id, _ := strconv.Atoi(w.Body.String())
+		return id, w.Result().Cookies()
+	}
+
+	first, cookies := request()
+	if first == 0 {
+		t.Fatal("no soul")
+	}
+
+	if again, _ := request(); again != first {
+		t.Fatalf("client without cookie got new soul %d, want %d", again, first)
+	}
+
+	if withCookie, _ := request(cookies...); withCookie != first {
+		t.Fatalf("cookie gave soul %d, want %d", withCookie, first)
+	}
+
+	if other, _ := request(); other == first || other == 0 {
+		t.Fatalf("other visitor got soul %d, first is %d", other, first)
+	}
+}
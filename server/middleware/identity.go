@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"tomashevich/server/utils"
+)
+
+const soulCookieName = "soul"
+
+// Identity signs soul id in cookie, so soul dont depend on ip address
+type Identity struct {
+	key    []byte
+	maxAge time.Duration
+	secure bool
+}
+
+func NewIdentity(config *utils.IdentityConfig) *Identity {
+	return &Identity{
+		key:    []byte(config.CookieKey),
+		maxAge: time.Duration(config.CookieMaxAge) * time.Second,
+		secure: config.SecureCookie,
+	}
+}
+
+// Enabled is false without key, then souls are identified only by ip
+func (i *Identity) Enabled() bool {
+	return len(i.key) > 0
+}
+
+func (i *Identity) sign(value string) string {
+	mac := hmac.New(sha256.New, i.key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SoulID returns id from valid cookie or 0
+func (i *Identity) SoulID(r *http.Request) int {
+	if !i.Enabled() {
+		return 0
+	}
+
+	cookie, err := r.Cookie(soulCookieName)
+	if err != nil {
+		return 0
+	}
+
+	value, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(i.sign(value))) {
+		return 0
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+
+	return id
+}
+
+func (i *Identity) ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     soulCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   i.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (i *Identity) SetCookie(w http.ResponseWriter, id int) {
+	if !i.Enabled() {
+		return
+	}
+
+	value := strconv.Itoa(id)
+	http.SetCookie(w, &http.Cookie{
+		Name:     soulCookieName,
+		Value:    value + "." + i.sign(value),
+		Path:     "/",
+		MaxAge:   int(i.maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   i.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
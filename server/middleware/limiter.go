@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/utils"
+)
+
+// Limiter decides if one more request of key is allowed. Its safe for concurrent use
+type Limiter interface {
+	Allow(key string, now time.Time) LimitResult
+	// Cleanup forgets keys which are back to full limit
+	Cleanup(now time.Time)
+
+	// Save and Load state of keys to survive restart. Load keeps expired keys, Cleanup removes them
+	Save() ([]database.RateLimitState, error)
+	Load(states []database.RateLimitState) error
+}
+
+type LimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Time     // when key is back to full limit
+	RetryAfter time.Duration // when not allowed, how long to wait for next request
+}
+
+const (
+	AlgorithmFixedWindow   = "fixed_window"
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmGCRA          = "gcra"
+)
+
+// NewLimiter makes limiter of config.Algorithm, fixed window if its empty
+func NewLimiter(config *utils.RateLimitPolicy) (Limiter, error) {
+	limit := config.MaxRequests
+	period := time.Duration(config.InSeconds) * time.Second
+	if limit <= 0 || period <= 0 {
+		return nil, fmt.Errorf("rate limiter needs max_requests and in_seconds")
+	}
+
+	switch config.Algorithm {
+	case "", AlgorithmFixedWindow:
+		return newFixedWindow(limit, period), nil
+	case AlgorithmSlidingWindow:
+		return newSlidingWindow(limit, period), nil
+	case AlgorithmTokenBucket:
+		return newTokenBucket(limit, period), nil
+	case AlgorithmGCRA:
+		return newGCRA(limit, period), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter algorithm %q", config.Algorithm)
+	}
+}
+
+// states are split between shards by key, lock of shard is held only while state is updated
+const limiterShards = 64
+
+type limiterShard[S any] struct {
+	mu     sync.Mutex
+	states map[string]*S
+}
+
+type limiterStates[S any] struct {
+	seed   maphash.Seed
+	shards [limiterShards]limiterShard[S]
+}
+
+func newLimiterStates[S any]() *limiterStates[S] {
+	l := &limiterStates[S]{seed: maphash.MakeSeed()}
+	for i := range l.shards {
+		l.shards[i].states = make(map[string]*S)
+	}
+	return l
+}
+
+// update runs fn with state of key under lock, new key gets zero state
+func (l *limiterStates[S]) update(key string, fn func(state *S) LimitResult) LimitResult {
+	shard := &l.shards[maphash.String(l.seed, key)%limiterShards]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	state, ok := shard.states[key]
+	if !ok {
+		state = new(S)
+		shard.states[key] = state
+	}
+
+	return fn(state)
+}
+
+func (l *limiterStates[S]) deleteFunc(fn func(state *S) bool) {
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mu.Lock()
+		for key, state := range shard.states {
+			if fn(state) {
+				delete(shard.states, key)
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
+
+func (l *limiterStates[S]) save() ([]database.RateLimitState, error) {
+	var states []database.RateLimitState
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mu.Lock()
+		for key, state := range shard.states {
+			data, err := json.Marshal(state)
+			if err != nil {
+				shard.mu.Unlock()
+				return nil, err
+			}
+			states = append(states, database.RateLimitState{Key: key, State: string(data)})
+		}
+		shard.mu.Unlock()
+	}
+	return states, nil
+}
+
+func (l *limiterStates[S]) load(states []database.RateLimitState) error {
+	for _, saved := range states {
+		state := new(S)
+		if err := json.Unmarshal([]byte(saved.State), state); err != nil {
+			return err
+		}
+
+		shard := &l.shards[maphash.String(l.seed, saved.Key)%limiterShards]
+		shard.mu.Lock()
+		shard.states[saved.Key] = state
+		shard.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"time"
+	"tomashevich/server/database"
+)
+
+// fixedWindow counts requests in window which starts with first request,
+// client can make 2x limit on border of two windows
+type fixedWindow struct {
+	limit  int
+	period time.Duration
+	states *limiterStates[fixedWindowState]
+}
+
+type fixedWindowState struct {
+	Count int       `json:"count"`
+	Reset time.Time `json:"reset"`
+}
+
+func newFixedWindow(limit int, period time.Duration) *fixedWindow {
+	return &fixedWindow{limit, period, newLimiterStates[fixedWindowState]()}
+}
+
+func (l *fixedWindow) Allow(key string, now time.Time) LimitResult {
+	return l.states.update(key, func(state *fixedWindowState) LimitResult {
+		if !now.Before(state.Reset) {
+			*state = fixedWindowState{0, now.Add(l.period)}
+		}
+
+		result := LimitResult{Limit: l.limit, Reset: state.Reset}
+		if state.Count >= l.limit {
+			result.RetryAfter = state.Reset.Sub(now)
+			return result
+		}
+
+		state.Count++
+		result.Allowed = true
+		result.Remaining = l.limit - state.Count
+		return result
+	})
+}
+
+func (l *fixedWindow) Cleanup(now time.Time) {
+	l.states.deleteFunc(func(state *fixedWindowState) bool {
+		return !now.Before(state.Reset)
+	})
+}
+
+func (l *fixedWindow) Save() ([]database.RateLimitState, error) {
+	return l.states.save()
+}
+
+func (l *fixedWindow) Load(states []database.RateLimitState) error {
+	return l.states.load(states)
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"time"
+	"tomashevich/server/database"
+)
+
+// gcra (generic cell rate algorithm) is token bucket which keeps only one time per key:
+// theoretical arrival time of next request. Requests go every period/limit, burst up to limit
+type gcra struct {
+	limit    int
+	period   time.Duration
+	interval time.Duration // between two requests, at least 1ns (limit can be more than nanoseconds in period)
+	states   *limiterStates[gcraState]
+}
+
+type gcraState struct {
+	TAT time.Time `json:"tat"`
+}
+
+func newGCRA(limit int, period time.Duration) *gcra {
+	return &gcra{limit, period, max(period/time.Duration(limit), 1), newLimiterStates[gcraState]()}
+}
+
+func (l *gcra) Allow(key string, now time.Time) LimitResult {
+	return l.states.update(key, func(state *gcraState) LimitResult {
+		tat := state.TAT
+		if tat.Before(now) {
+			tat = now
+		}
+
+		result := LimitResult{Limit: l.limit}
+		next := tat.Add(l.interval)
+		// request is allowed if next tat is not further than burst of limit requests
+		if allowAt := next.Add(-l.period); now.Before(allowAt) {
+			result.RetryAfter = allowAt.Sub(now)
+			result.Reset = tat
+			result.Remaining = 0
+			return result
+		}
+
+		state.TAT = next
+		result.Allowed = true
+		result.Reset = next
+		result.Remaining = int((l.period - next.Sub(now)) / l.interval)
+		return result
+	})
+}
+
+func (l *gcra) Cleanup(now time.Time) {
+	l.states.deleteFunc(func(state *gcraState) bool {
+		return !now.Before(state.TAT)
+	})
+}
+
+func (l *gcra) Save() ([]database.RateLimitState, error) {
+	return l.states.save()
+}
+
+func (l *gcra) Load(states []database.RateLimitState) error {
+	return l.states.load(states)
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"time"
+	"tomashevich/server/database"
+)
+
+// slidingWindow keeps time of every request in last period, exact but takes limit times of memory per key
+type slidingWindow struct {
+	limit  int
+	period time.Duration
+	states *limiterStates[slidingWindowState]
+}
+
+type slidingWindowState struct {
+	Log []time.Time `json:"log"` // oldest first
+}
+
+func newSlidingWindow(limit int, period time.Duration) *slidingWindow {
+	return &slidingWindow{limit, period, newLimiterStates[slidingWindowState]()}
+}
+
+func (state *slidingWindowState) drop(now time.Time, period time.Duration) {
+	i := 0
+	for i < len(state.Log) && !now.Before(state.Log[i].Add(period)) {
+		i++
+	}
+	state.Log = state.Log[i:]
+}
+
+func (l *slidingWindow) Allow(key string, now time.Time) LimitResult {
+	return l.states.update(key, func(state *slidingWindowState) LimitResult {
+		state.drop(now, l.period)
+
+		result := LimitResult{Limit: l.limit}
+		if len(state.Log) >= l.limit {
+			result.Reset = state.Log[len(state.Log)-1].Add(l.period)
+			result.RetryAfter = state.Log[0].Add(l.period).Sub(now)
+			return result
+		}
+
+		state.Log = append(state.Log, now)
+		result.Allowed = true
+		result.Remaining = l.limit - len(state.Log)
+		result.Reset = now.Add(l.period)
+		return result
+	})
+}
+
+func (l *slidingWindow) Cleanup(now time.Time) {
+	l.states.deleteFunc(func(state *slidingWindowState) bool {
+		state.drop(now, l.period)
+		return len(state.Log) == 0
+	})
+}
+
+func (l *slidingWindow) Save() ([]database.RateLimitState, error) {
+	return l.states.save()
+}
+
+func (l *slidingWindow) Load(states []database.RateLimitState) error {
+	return l.states.load(states)
+}
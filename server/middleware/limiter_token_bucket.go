@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"math"
+	"time"
+	"tomashevich/server/database"
+)
+
+// tokenBucket holds limit tokens, one is refilled every period/limit, request takes one token
+type tokenBucket struct {
+	limit  int
+	refill time.Duration // for one token
+	states *limiterStates[tokenBucketState]
+}
+
+type tokenBucketState struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+func newTokenBucket(limit int, period time.Duration) *tokenBucket {
+	return &tokenBucket{limit, max(period/time.Duration(limit), 1), newLimiterStates[tokenBucketState]()}
+}
+
+func (l *tokenBucket) fill(state *tokenBucketState, now time.Time) {
+	if state.Updated.IsZero() {
+		state.Tokens = float64(l.limit)
+	} else {
+		state.Tokens = min(float64(l.limit), state.Tokens+float64(now.Sub(state.Updated))/float64(l.refill))
+	}
+	state.Updated = now
+}
+
+func (l *tokenBucket) Allow(key string, now time.Time) LimitResult {
+	return l.states.update(key, func(state *tokenBucketState) LimitResult {
+		l.fill(state, now)
+
+		result := LimitResult{Limit: l.limit}
+		if state.Tokens < 1 {
+			result.RetryAfter = time.Duration((1 - state.Tokens) * float64(l.refill))
+		} else {
+			state.Tokens--
+			result.Allowed = true
+		}
+
+		result.Remaining = int(math.Floor(state.Tokens))
+		result.Reset = now.Add(time.Duration((float64(l.limit) - state.Tokens) * float64(l.refill)))
+		return result
+	})
+}
+
+func (l *tokenBucket) Cleanup(now time.Time) {
+	l.states.deleteFunc(func(state *tokenBucketState) bool {
+		l.fill(state, now)
+		return state.Tokens >= float64(l.limit)
+	})
+}
+
+func (l *tokenBucket) Save() ([]database.RateLimitState, error) {
+	return l.states.save()
+}
+
+func (l *tokenBucket) Load(states []database.RateLimitState) error {
+	return l.states.load(states)
+}
@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/utils"
+)
+
+var (
+	ErrChallengeInvalid = errors.New("invalid challenge")
+	ErrChallengeExpired = errors.New("challenge expired")
+	ErrChallengeUsed    = errors.New("challenge already used")
+	ErrChallengeWrong   = errors.New("nonce dont solve challenge")
+)
+
+// ProofOfWork gives hashcash challenges: sha256(challenge + nonce) must start with difficulty zero bits.
+// Challenge is signed "<soul>.<expires>.<difficulty>.<random>", so server keeps only used ones
+type ProofOfWork struct {
+	config   *utils.ProofOfWorkConfig
+	server   *utils.ServerConfig
+	key      []byte // random on every start, challenges live only ttl anyway
+	ttl      time.Duration
+	networks []netip.Prefix
+	rate     Limiter // challenges of address, over limit => suspicious
+
+	mu   sync.Mutex
+	used map[string]time.Time // challenge => expires
+}
+
+func NewProofOfWork(config *utils.ProofOfWorkConfig, server *utils.ServerConfig) (*ProofOfWork, error) {
+	p := &ProofOfWork{
+		config: config,
+		server: server,
+		key:    make([]byte, 32),
+		ttl:    time.Duration(config.TTL) * time.Second,
+		used:   make(map[string]time.Time),
+	}
+
+	if !config.Enabled {
+		return p, nil
+	}
+
+	if p.ttl <= 0 {
+		return nil, fmt.Errorf("proof of work needs ttl")
+	}
+
+	rand.Read(p.key)
+
+	for _, network := range config.SuspiciousNetworks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("suspicious network %q: %w", network, err)
+		}
+		p.networks = append(p.networks, prefix.Masked())
+	}
+
+	rate, err := NewLimiter(&config.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("proof of work rate limit: %w", err)
+	}
+	p.rate = rate
+
+	return p, nil
+}
+
+func (p *ProofOfWork) Enabled() bool {
+	return p.config.Enabled
+}
+
+// Difficulty grows for new soul, many challenges from same address and suspicious networks.
+// Its called once per challenge, so it counts challenges of address
+func (p *ProofOfWork) Difficulty(r *http.Request, soul database.Soul) int {
+	if IsAllowed(r.Context()) {
+		return 0
+	}
+
+	now := time.Now()
+	difficulty := p.config.Difficulty
+
+	if soul.CreatedAt != 0 && now.Sub(time.Unix(soul.CreatedAt, 0)) < time.Duration(p.config.NewSoulAge)*time.Second {
+		difficulty += p.config.NewSoulDifficulty
+	}
+
+	if !p.rate.Allow(utils.GetAddr(r, p.server), now).Allowed {
+		difficulty += p.config.RateDifficulty
+	}
+
+	if addr, err := netip.ParseAddr(utils.GetIPAddr(r, p.server)); err == nil {
+		for _, network := range p.networks {
+			if network.Contains(addr) {
+				difficulty += p.config.NetworkDifficulty
+				break
+			}
+		}
+	}
+
+	return min(difficulty, p.config.MaxDifficulty)
+}
+
+func (p *ProofOfWork) sign(value string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (p *ProofOfWork) Challenge(soulID, difficulty int) (string, time.Time) {
+	expires := time.Now().Add(p.ttl)
+
+	random := make([]byte, 12)
+	rand.Read(random)
+
+	value := fmt.Sprintf("%d.%d.%d.%s", soulID, expires.Unix(), difficulty, base64.RawURLEncoding.EncodeToString(random))
+	return value + "." + p.sign(value), expires
+}
+
+// Verify checks that challenge is given to soul and solved by nonce, every challenge can be used once
+func (p *ProofOfWork) Verify(challenge, nonce string, soulID int) error {
+	value, signature, ok := cutLast(challenge, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(p.sign(value))) {
+		return ErrChallengeInvalid
+	}
+
+	parts := strings.Split(value, ".")
+	if len(parts) != 4 || parts[0] != strconv.Itoa(soulID) || len(nonce) > 32 {
+		return ErrChallengeInvalid
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrChallengeInvalid
+	}
+	expires := time.Unix(expiresAt, 0)
+	if !time.Now().Before(expires) {
+		return ErrChallengeExpired
+	}
+
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ErrChallengeInvalid
+	}
+
+	hash := sha256.Sum256([]byte(challenge + nonce))
+	if leadingZeroBits(hash[:]) < difficulty {
+		return ErrChallengeWrong
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.used[challenge]; ok {
+		return ErrChallengeUsed
+	}
+	p.used[challenge] = expires
+
+	return nil
+}
+
+// Release makes verified challenge usable again, when paint failed after Verify,
+// so solved work isnt burned by server error
+func (p *ProofOfWork) Release(challenge string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.used, challenge)
+}
+
+// Run forgets expired challenges and rate counters until ctx is done
+func (p *ProofOfWork) Run(ctx context.Context) {
+	if !p.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(p.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.rate.Cleanup(now)
+
+			p.mu.Lock()
+			for challenge, expires := range p.used {
+				if !now.Before(expires) {
+					delete(p.used, challenge)
+				}
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+func leadingZeroBits(hash []byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i == -1 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
@@ -1,94 +1,257 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
+	"tomashevich/server/database"
 	"tomashevich/server/utils"
 )
 
-type RequestLimitState struct {
-	Count     int
-	ResetTime time.Time
+// parts of rate limit key
+const (
+	KeyIP    = "ip"
+	KeySoul  = "soul"
+	KeyRoute = "route"
+)
+
+type policyLimiter struct {
+	Limiter
+	id     string   // saved states are restored only to same route and policy
+	policy string   // RateLimit-Policy header
+	key    []string // parts of key
 }
 
 type RateLimiter struct {
-	mu          sync.Mutex
-	requests    map[string]*RequestLimitState
-	MaxRequests int
-	InDuration  time.Duration
+	name     string // of saved states
+	limiter  *policyLimiter
+	routes   map[string]*policyLimiter // by route pattern, nil => exempt
+	router   *http.ServeMux
+	db       *database.Database
+	hasher   *utils.AddressHasher
+	interval time.Duration // of cleaner
+	snapshot time.Duration // 0 => state is not saved
 }
 
-func NewRateLimiter(maxRequests int, inDuration time.Duration) *RateLimiter {
-	return &RateLimiter{
-		requests:    make(map[string]*RequestLimitState),
-		MaxRequests: maxRequests,
-		InDuration:  inDuration,
+// NewRateLimiter makes limiter with policies of config.Routes for patterns of router.
+// Without router (limiter of one handler) only default policy is used
+func NewRateLimiter(name string, config *utils.RateLimiterConfig, router *http.ServeMux, db *database.Database, hasher *utils.AddressHasher) (*RateLimiter, error) {
+	limiter, err := newPolicyLimiter("", &config.RateLimitPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	rl := &RateLimiter{
+		name:     name,
+		limiter:  limiter,
+		routes:   make(map[string]*policyLimiter),
+		router:   router,
+		db:       db,
+		hasher:   hasher,
+		interval: time.Duration(config.InSeconds) * time.Second,
+		snapshot: time.Duration(config.SnapshotInterval) * time.Second,
+	}
+
+	for pattern, policy := range config.Routes {
+		if policy.Exempt {
+			rl.routes[pattern] = nil
+			continue
+		}
+
+		limiter, err := newPolicyLimiter(pattern, &policy)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", pattern, err)
+		}
+		rl.routes[pattern] = limiter
 	}
+
+	return rl, nil
 }
 
-func (rl *RateLimiter) RunCleaner() {
-	ticker := time.NewTicker(rl.InDuration)
+func newPolicyLimiter(pattern string, policy *utils.RateLimitPolicy) (*policyLimiter, error) {
+	limiter, err := NewLimiter(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	key := []string{KeyIP}
+	if policy.Key != "" {
+		key = strings.Split(policy.Key, "+")
+	}
+	for _, part := range key {
+		if part != KeyIP && part != KeySoul && part != KeyRoute {
+			return nil, fmt.Errorf("unknown part %q of rate limit key", part)
+		}
+	}
+
+	algorithm := policy.Algorithm
+	if algorithm == "" {
+		algorithm = AlgorithmFixedWindow
+	}
 
-	go func() {
-		for range ticker.C {
-			rl.mu.Lock()
+	return &policyLimiter{
+		Limiter: limiter,
+		id:      fmt.Sprintf("%s %s %d/%d %s", pattern, algorithm, policy.MaxRequests, policy.InSeconds, strings.Join(key, "+")),
+		policy:  fmt.Sprintf("%d;w=%d", policy.MaxRequests, policy.InSeconds),
+		key:     key,
+	}, nil
+}
 
-			now := time.Now()
-			for ip, state := range rl.requests {
-				if now.After(state.ResetTime) {
-					delete(rl.requests, ip)
-				}
+// address in key is hashed, so saved states dont have ips
+func (l *policyLimiter) keyOf(r *http.Request, pattern string, config *utils.ServerConfig, hasher *utils.AddressHasher) string {
+	parts := make([]string, 0, len(l.key))
+	for _, part := range l.key {
+		switch part {
+		case KeyIP:
+			parts = append(parts, "ip:"+hasher.Hash(utils.GetAddr(r, config)))
+		case KeySoul:
+			if id := PeekSoulID(r.Context()); id != 0 {
+				parts = append(parts, "soul:"+strconv.Itoa(id))
+			} else {
+				parts = append(parts, "ip:"+hasher.Hash(utils.GetAddr(r, config)))
 			}
+		case KeyRoute:
+			parts = append(parts, "route:"+pattern)
+		}
+	}
+	return strings.Join(parts, "|")
+}
 
-			rl.mu.Unlock()
+func (rl *RateLimiter) limiters() []*policyLimiter {
+	limiters := []*policyLimiter{rl.limiter}
+	for _, limiter := range rl.routes {
+		if limiter != nil {
+			limiters = append(limiters, limiter)
 		}
-	}()
+	}
+	return limiters
 }
 
-func (rl *RateLimiter) Middleware(isBehindProxy bool) func(next http.Handler) http.Handler {
-	rl.RunCleaner()
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := utils.GetIPAddr(r, isBehindProxy)
-			now := time.Now()
+// Restore loads saved state, keys which are expired already are dropped
+func (rl *RateLimiter) Restore(ctx context.Context) error {
+	if rl.snapshot <= 0 {
+		return nil
+	}
+
+	states, err := rl.db.GetRateLimits(ctx, rl.name)
+	if err != nil {
+		return err
+	}
+
+	byPolicy := make(map[string][]database.RateLimitState)
+	for _, state := range states {
+		byPolicy[state.Policy] = append(byPolicy[state.Policy], state)
+	}
+
+	now := time.Now()
+	for _, limiter := range rl.limiters() {
+		if err := limiter.Load(byPolicy[limiter.id]); err != nil {
+			return fmt.Errorf("policy %q: %w", limiter.id, err)
+		}
+		limiter.Cleanup(now)
+	}
+
+	return nil
+}
+
+func (rl *RateLimiter) save() {
+	var states []database.RateLimitState
+	for _, limiter := range rl.limiters() {
+		saved, err := limiter.Save()
+		if err != nil {
+			log.Printf("cant save rate limiter %s policy %q: %v", rl.name, limiter.id, err)
+			return
+		}
+		for i := range saved {
+			saved[i].Policy = limiter.id
+		}
+		states = append(states, saved...)
+	}
+
+	if err := rl.db.SaveRateLimits(context.Background(), rl.name, states); err != nil {
+		log.Printf("cant save rate limiter %s: %v", rl.name, err)
+	}
+}
+
+// Run cleans expired keys and saves state every snapshot interval until ctx is done,
+// state is saved last time before return
+func (rl *RateLimiter) Run(ctx context.Context) {
+	cleaner := time.NewTicker(rl.interval)
+	defer cleaner.Stop()
 
-			rl.mu.Lock()
-			defer rl.mu.Unlock()
+	var snapshots <-chan time.Time
+	if rl.snapshot > 0 {
+		ticker := time.NewTicker(rl.snapshot)
+		defer ticker.Stop()
+		snapshots = ticker.C
+	}
 
-			state, exists := rl.requests[ip]
-			if exists && now.After(state.ResetTime) {
-				delete(rl.requests, ip)
-				exists = false // Обрабатываем как новый запрос
+	for {
+		select {
+		case <-ctx.Done():
+			if rl.snapshot > 0 {
+				rl.save()
+			}
+			return
+		case now := <-cleaner.C:
+			for _, limiter := range rl.limiters() {
+				limiter.Cleanup(now)
 			}
+		case <-snapshots:
+			rl.save()
+		}
+	}
+}
+
+// limiterFor returns limiter and pattern of route which will handle request, nil limiter if route is exempt
+func (rl *RateLimiter) limiterFor(r *http.Request) (*policyLimiter, string) {
+	if rl.router == nil {
+		return rl.limiter, ""
+	}
 
-			if !exists {
-				state = &RequestLimitState{
-					1,
-					now.Add(rl.InDuration),
-				}
-				rl.requests[ip] = state
-				rl.SetHeaders(w, state)
+	_, pattern := rl.router.Handler(r)
+	if limiter, ok := rl.routes[pattern]; ok {
+		return limiter, pattern
+	}
+	return rl.limiter, pattern
+}
+
+func (rl *RateLimiter) Middleware(config *utils.ServerConfig) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter, pattern := rl.limiterFor(r)
+			if limiter == nil || IsAllowed(r.Context()) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			rl.SetHeaders(w, state)
+			result := limiter.Allow(limiter.keyOf(r, pattern, config, rl.hasher), time.Now())
+			SetRateLimitHeaders(w, limiter.policy, result)
 
-			if state.Count >= rl.MaxRequests {
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
 				utils.WriteError(w, "rate limit", http.StatusTooManyRequests)
 				return
 			}
 
-			state.Count++
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-func (rl *RateLimiter) SetHeaders(w http.ResponseWriter, state *RequestLimitState) {
-	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rl.MaxRequests))
-	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(rl.MaxRequests-state.Count))
-	w.Header().Set("X-RateLimit-Reset", state.ResetTime.Format(time.RFC1123))
+// SetRateLimitHeaders sets RateLimit-* headers of ietf draft, reset is in seconds from now
+func SetRateLimitHeaders(w http.ResponseWriter, policy string, result LimitResult) {
+	w.Header().Set("RateLimit-Policy", policy)
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(time.Until(result.Reset))))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 0)
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tomashevich/server/utils"
+)
+
+// BenchmarkRateLimiterParallel shows that slow handlers dont wait for each other in limiter:
+// ns/op should be close to handler time divided by GOMAXPROCS, not handler time
+func BenchmarkRateLimiterParallel(b *testing.B) {
+	const handlerTime = time.Millisecond
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(handlerTime)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &utils.ServerConfig{}
+	hasher := utils.NewAddressHasher(nil)
+
+	for _, algorithm := range []string{AlgorithmFixedWindow, AlgorithmSlidingWindow, AlgorithmTokenBucket, AlgorithmGCRA} {
+		b.Run(algorithm, func(b *testing.B) {
+			config := &utils.RateLimiterConfig{
+				RateLimitPolicy: utils.RateLimitPolicy{Algorithm: algorithm, MaxRequests: 1_000_000, InSeconds: 1},
+			}
+
+			limiter, err := NewRateLimiter("benchmark", config, nil, nil, hasher)
+			if err != nil {
+				b.Fatal(err)
+			}
+			handler := limiter.Middleware(server)(slow)
+
+			var clients atomic.Int64
+			b.SetParallelism(16)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				// every goroutine is other client, so requests go to different shards
+				client := clients.Add(1)
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = fmt.Sprintf("10.%d.%d.1:1234", client/256, client%256)
+
+				for pb.Next() {
+					w := httptest.NewRecorder()
+					handler.ServeHTTP(w, r)
+					if w.Code != http.StatusNoContent {
+						b.Fatalf("unexpected status %d", w.Code)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+	"tomashevich/server/utils"
+)
+
+// SoulCache keeps resolved souls, so helheim dont ask database on every api call
+type SoulCache struct {
+	souls  *utils.LRU[string, int] // cookie:<id> or address:<hash> => soul id
+	flight flightGroup
+}
+
+func NewSoulCache(config *utils.IdentityConfig) *SoulCache {
+	return &SoulCache{
+		souls:  utils.NewLRU[string, int](config.CacheSize, time.Duration(config.CacheTTL)*time.Second),
+		flight: flightGroup{calls: make(map[string]*flightCall)},
+	}
+}
+
+// Forget must be called when soul is erased, deleted or moved to other address,
+// it drops both cookie and address keys of soul
+func (c *SoulCache) Forget(id int) {
+	c.souls.DeleteFunc(func(_ string, soulID int) bool {
+		return soulID == id
+	})
+}
+
+// flightGroup runs one call per key, others with same key wait and share its result
+// (so few requests of first visit make one soul)
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg      sync.WaitGroup
+	id      int
+	created bool
+	waiters int
+}
+
+// Do returns result of fn and true if result is shared: taken from other call,
+// or other calls waited for this one
+func (g *flightGroup) Do(key string, fn func() (int, bool)) (id int, created bool, shared bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.id, call.created, true
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		shared = call.waiters > 0
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.id, call.created = fn()
+	return call.id, call.created, false
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tomashevich/server/database"
+	"tomashevich/server/utils"
+)
+
+// Sybil caps new souls per network (like /24 or /48), so rotating ips dont give unlimited souls.
+// Visitors over cap share drifter soul, it cant paint
+type Sybil struct {
+	config  *utils.SybilConfig
+	server  *utils.ServerConfig
+	limiter Limiter // nil => no cap
+	drifter int
+	period  time.Duration
+
+	newSouls atomic.Int64
+	drifters atomic.Int64
+
+	mu     sync.Mutex
+	capped map[string]time.Time // network => end of cap
+}
+
+func NewSybil(ctx context.Context, db *database.Database, config *utils.SybilConfig, server *utils.ServerConfig) (*Sybil, error) {
+	drifter, err := db.GetDrifterID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cant find drifter soul: %w", err)
+	}
+
+	defaults := *config
+	if defaults.IPv4Prefix == 0 {
+		defaults.IPv4Prefix = server.IPv4Prefix
+	}
+	if defaults.IPv6Prefix == 0 {
+		defaults.IPv6Prefix = server.IPv6Prefix
+	}
+	config = &defaults
+
+	s := &Sybil{
+		config:  config,
+		server:  server,
+		drifter: drifter,
+		period:  time.Duration(config.NewSouls.InSeconds) * time.Second,
+		capped:  make(map[string]time.Time),
+	}
+
+	if config.NewSouls.MaxRequests <= 0 {
+		return s, nil
+	}
+
+	if s.limiter, err = NewLimiter(&config.NewSouls); err != nil {
+		return nil, fmt.Errorf("sybil new souls: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *Sybil) Drifter() int {
+	return s.drifter
+}
+
+// AllowNewSoul counts new soul of request network, false if network is over cap
+func (s *Sybil) AllowNewSoul(r *http.Request) bool {
+	if s.limiter == nil || IsAllowed(r.Context()) {
+		s.newSouls.Add(1)
+		return true
+	}
+
+	network := utils.AggregateAddr(utils.GetIPAddr(r, s.server), s.config.IPv4Prefix, s.config.IPv6Prefix)
+	now := time.Now()
+
+	result := s.limiter.Allow(network, now)
+	if result.Allowed {
+		s.newSouls.Add(1)
+		return true
+	}
+
+	s.drifters.Add(1)
+
+	s.mu.Lock()
+	s.capped[network] = now.Add(result.RetryAfter)
+	s.mu.Unlock()
+
+	return false
+}
+
+// Run forgets old counters and caps until ctx is done
+func (s *Sybil) Run(ctx context.Context) {
+	if s.limiter == nil {
+		return
+	}
+
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.limiter.Cleanup(now)
+
+			s.mu.Lock()
+			for network, until := range s.capped {
+				if !now.Before(until) {
+					delete(s.capped, network)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Sybil) cappedNetworks() int {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, until := range s.capped {
+		if now.Before(until) {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteMetrics writes counters and thresholds in prometheus text format
+func (s *Sybil) WriteMetrics(w io.Writer) {
+	metrics := []struct {
+		name, kind, help string
+		value            int64
+	}{
+		{"tomashevich_new_souls_total", "counter", "New souls allowed by sybil cap", s.newSouls.Load()},
+		{"tomashevich_drifters_total", "counter", "Visitors given drifter soul because their network is over cap", s.drifters.Load()},
+		{"tomashevich_sybil_capped_networks", "gauge", "Networks over new souls cap now", int64(s.cappedNetworks())},
+		{"tomashevich_sybil_max_new_souls", "gauge", "New souls allowed per network in window, 0 => no cap", int64(s.config.NewSouls.MaxRequests)},
+		{"tomashevich_sybil_window_seconds", "gauge", "Window of new souls cap", int64(s.config.NewSouls.InSeconds)},
+		{"tomashevich_sybil_ipv4_prefix", "gauge", "Prefix of ipv4 network", int64(s.config.IPv4Prefix)},
+		{"tomashevich_sybil_ipv6_prefix", "gauge", "Prefix of ipv6 network", int64(s.config.IPv6Prefix)},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
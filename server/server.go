@@ -1,9 +1,15 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"tomashevich/server/database"
@@ -26,13 +32,79 @@ func NewServer(config *utils.Config, staticFiles fs.FS, database *database.Datab
 	}
 }
 
+// Run serves until SIGINT/SIGTERM, then waits for requests and background writers
 func (s Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	router := http.NewServeMux()
 
+	identity := middleware.NewIdentity(&s.config.Identity)
+	if !identity.Enabled() {
+		log.Printf("identity.cookie_key is empty, souls are identified only by ip")
+	}
+
+	hasher := utils.NewAddressHasher(s.config.Identity.AddressKeys)
+	if !hasher.Enabled() {
+		log.Printf("identity.address_keys is empty, addresses are stored as is")
+	}
+
+	soulCache := middleware.NewSoulCache(&s.config.Identity)
+	activity := middleware.NewActivity(s.database, &s.config.Identity)
+
+	rateLimiter, err := middleware.NewRateLimiter("ratelimiter", &s.config.RateLimiter, router, s.database, hasher)
+	if err != nil {
+		return err
+	}
+
+	claimLimiter, err := middleware.NewRateLimiter("claim_ratelimiter", &s.config.ClaimLimiter, nil, s.database, hasher)
+	if err != nil {
+		return err
+	}
+
+	pow, err := middleware.NewProofOfWork(&s.config.ProofOfWork, &s.config.Server)
+	if err != nil {
+		return err
+	}
+
+	sybil, err := middleware.NewSybil(ctx, s.database, &s.config.Sybil, &s.config.Server)
+	if err != nil {
+		return err
+	}
+
+	bans := middleware.NewBanList(s.database, &s.config.Bans)
+	if err := bans.Load(ctx); err != nil {
+		return err
+	}
+
+	for _, limiter := range []*middleware.RateLimiter{rateLimiter, claimLimiter} {
+		if err := limiter.Restore(ctx); err != nil {
+			return err
+		}
+	}
+
+	// background writers are stopped after last request, they save their state before exit
+	background, stopBackground := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		stopBackground()
+		wg.Wait()
+	}()
+
+	for _, run := range []func(context.Context){activity.Run, rateLimiter.Run, claimLimiter.Run, bans.Run, pow.Run, sybil.Run} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(background)
+		}()
+	}
+
+	// last is first: bans, helheim (rate limiter counts souls), rate limiter
 	stack := middleware.MiddlewareStack(
-		middleware.Helheim(s.database, s.config.Server.IsBehindProxy),
 		middleware.Compress(),
-		middleware.NewRateLimiter(s.config.RateLimiter.MaxRequests, time.Duration(s.config.RateLimiter.InSeconds)*time.Second).Middleware(s.config.Server.IsBehindProxy),
+		rateLimiter.Middleware(&s.config.Server),
+		middleware.Helheim(s.database, identity, hasher, soulCache, activity, sybil, &s.config.Server),
+		bans.Middleware(identity, &s.config.Server),
 	)
 
 	server := http.Server{
@@ -47,10 +119,38 @@ func (s Server) Run() error {
 	router.Handle("/", middleware.Cache(time.Second*time.Duration(s.config.Caches.StaticFiles))(http.FileServerFS(s.staticFiles)))
 
 	// Register API handler
-	handler.RegisterFishes(router, s.database, &s.config.Caches)
-	handler.RegisterPixels(router, s.database, &s.config.Caches)
+	handler.RegisterFishes(router, s.database, &s.config.Caches, &s.config.Fishes)
+	handler.RegisterBreeding(router, s.database, &s.config.Fishes)
+	handler.RegisterCatches(router, s.database, &s.config.Fishes)
+	handler.RegisterDaily(router, s.database)
+	if s.config.Aquarium.Enabled() {
+		handler.RegisterAquarium(router, s.database, &s.config.Aquarium, &s.config.Caches)
+	} else {
+		log.Printf("aquarium section is empty, aquarium picture is not served")
+	}
+	handler.RegisterSouls(router, s.database, identity, soulCache, activity)
+	handler.RegisterPixels(router, s.database, &s.config.Caches, pow)
+	handler.RegisterMetrics(router, sybil)
+	handler.RegisterClaims(router, s.database, claimLimiter.Middleware(&s.config.Server), identity, soulCache, hasher, &s.config.Server, &s.config.Identity)
+
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+		close(stopped)
+	}()
 
 	log.Printf("starting server at %s", s.config.Server.Address)
 
-	return server.ListenAndServe()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Shutdown returns when requests are done
+	<-stopped
+	log.Printf("server stopped")
+	return nil
 }
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// AddressHasher pseudonymizes addresses before they go to database.
+// First key hashes addresses, other keys are previous ones which are still searched while key is rotated
+type AddressHasher struct {
+	keys [][]byte
+}
+
+func NewAddressHasher(keys []string) *AddressHasher {
+	hasher := &AddressHasher{}
+	for _, key := range keys {
+		hasher.keys = append(hasher.keys, []byte(key))
+	}
+	return hasher
+}
+
+// Enabled is false without keys, then addresses are stored as is
+func (h *AddressHasher) Enabled() bool {
+	return len(h.keys) > 0
+}
+
+func (h *AddressHasher) hash(key []byte, address string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(address))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (h *AddressHasher) Hash(address string) string {
+	if !h.Enabled() {
+		return address
+	}
+	return h.hash(h.keys[0], address)
+}
+
+// PreviousHashes are hashes of address by old keys
+func (h *AddressHasher) PreviousHashes(address string) []string {
+	if len(h.keys) < 2 {
+		return nil
+	}
+
+	hashes := make([]string, 0, len(h.keys)-1)
+	for _, key := range h.keys[1:] {
+		hashes = append(hashes, h.hash(key, address))
+	}
+	return hashes
+}
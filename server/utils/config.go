@@ -1,33 +1,205 @@
 package utils
 
 import (
+	"fmt"
+	"net/netip"
 	"os"
+	"path/filepath"
 )
 
 type Config struct {
 	DatabaseFile string            `json:"database_file"` // sqlite3 database file
 	Server       ServerConfig      `json:"server"`
 	RateLimiter  RateLimiterConfig `json:"ratelimiter"`
+	ClaimLimiter RateLimiterConfig `json:"claim_ratelimiter"` // against bruteforce of soul claim tokens
 	Caches       CacheConfig       `json:"caches"`
+	Fishes       FishesConfig      `json:"fishes"`
+	Aquarium     AquariumConfig    `json:"aquarium"`
+	Identity     IdentityConfig    `json:"identity"`
+	Bans         BansConfig        `json:"bans"`
+	ProofOfWork  ProofOfWorkConfig `json:"proof_of_work"`
+	Sybil        SybilConfig       `json:"sybil"`
 }
 
 type ServerConfig struct {
 	Address       string `json:"address"`
 	IsBehindProxy bool   `json:"is_behind_proxy"`
-	ReadTimeout   int    `json:"read_timeout"`
-	WriteTimeout  int    `json:"write_timeout"`
-	IdleTimeout   int    `json:"idle_timeout"`
+	IPv4Prefix    int    `json:"ipv4_prefix"` // clients in same network are one client
+	IPv6Prefix    int    `json:"ipv6_prefix"` // for souls and rate limits, 0 => full address
+
+	TrustedProxies  []string `json:"trusted_proxies"`  // CIDRs of proxies, empty => loopback and private
+	ClientIPHeader  string   `json:"client_ip_header"` // X-Real-IP, CF-Connecting-IP, empty => forwarded_header
+	ForwardedHeader string   `json:"forwarded_header"` // Forwarded or X-Forwarded-For, one which proxy sets. empty => X-Forwarded-For
+
+	ReadTimeout  int `json:"read_timeout"`
+	WriteTimeout int `json:"write_timeout"`
+	IdleTimeout  int `json:"idle_timeout"`
+
+	trustedProxies []netip.Prefix // parsed TrustedProxies, filled by validate()
+}
+
+type IdentityConfig struct {
+	CookieKey    string `json:"cookie_key"`     // hmac key of soul cookie, empty => souls only by ip
+	CookieMaxAge int    `json:"cookie_max_age"` // in seconds
+	SecureCookie bool   `json:"secure_cookie"`  // send cookie only over https
+
+	AddressKeys []string `json:"address_keys"` // hmac keys of stored addresses, first is current, others are old ones while rotating
+
+	CacheSize int `json:"cache_size"` // how many resolved souls helheim keeps in memory, 0 => no cache
+	CacheTTL  int `json:"cache_ttl"`  // in seconds
+
+	ActivityInterval int `json:"activity_interval"` // how often seen souls are written, in seconds
+	VisitGap         int `json:"visit_gap"`         // soul not seen for this many seconds makes new visit
+
+	ClaimTokenTTL int `json:"claim_token_ttl"` // exported token can be claimed this many seconds, 0 => 1 day
+}
+
+// difficulties are leading zero bits of sha256, every bit doubles work
+type ProofOfWorkConfig struct {
+	Enabled       bool `json:"enabled"` // paint needs solved challenge
+	TTL           int  `json:"ttl"`     // of challenge, in seconds
+	Difficulty    int  `json:"difficulty"`
+	MaxDifficulty int  `json:"max_difficulty"`
+
+	NewSoulAge        int `json:"new_soul_age"` // soul younger than this (in seconds) is new
+	NewSoulDifficulty int `json:"new_soul_difficulty"`
+
+	RateLimit      RateLimitPolicy `json:"rate_limit"` // challenges of address over it are suspicious
+	RateDifficulty int             `json:"rate_difficulty"`
+
+	SuspiciousNetworks []string `json:"suspicious_networks"` // CIDRs
+	NetworkDifficulty  int      `json:"network_difficulty"`
+}
+
+type SybilConfig struct {
+	IPv4Prefix int `json:"ipv4_prefix"` // network which shares new souls cap, 0 => server.ipv4_prefix
+	IPv6Prefix int `json:"ipv6_prefix"` // 0 => server.ipv6_prefix
+
+	NewSouls RateLimitPolicy `json:"new_souls"` // per network, max_requests 0 => no cap
+}
+
+type BansConfig struct {
+	ReloadInterval int `json:"reload_interval"` // in seconds, bans added by command are applied after it
+}
+
+type RateLimitPolicy struct {
+	Algorithm   string `json:"algorithm"` // fixed_window, sliding_window, token_bucket, gcra, empty => fixed_window
+	MaxRequests int    `json:"max_requests"`
+	InSeconds   int    `json:"in_seconds"`
+	Exempt      bool   `json:"exempt"` // route is not limited at all
+
+	// what is counted: ip, soul, or composite like soul+route, ip+route. empty => ip.
+	// Client without soul cookie is counted by ip
+	Key string `json:"key"`
 }
 
 type RateLimiterConfig struct {
-	MaxRequests int `json:"max_requests"`
-	InSeconds   int `json:"in_seconds"`
+	RateLimitPolicy // for routes without own policy
+
+	SnapshotInterval int `json:"snapshot_interval"` // state is saved to database every N seconds and on shutdown, 0 => not saved
+
+	// by pattern of route as its registered, like "POST /pixels:paint" or "/" for static files.
+	// Every route has its own counters
+	Routes map[string]RateLimitPolicy `json:"routes"`
+}
+
+type FishesConfig struct {
+	RerollLimit   int `json:"reroll_limit"`   // how many times soul can change seed
+	RerollPeriod  int `json:"reroll_period"`  // in seconds
+	BreedLimit    int `json:"breed_limit"`    // how many new fishes soul can breed
+	BreedPeriod   int `json:"breed_period"`   // in seconds
+	CatchCooldown int `json:"catch_cooldown"` // seconds between catches of soul
+}
+
+type AquariumConfig struct {
+	Fishes          int     `json:"fishes"`           // default count of fishes on picture
+	MaxFishes       int     `json:"max_fishes"`       // max count of fishes from ?n=
+	Width           int     `json:"width"`            // picture width in pixels
+	Height          int     `json:"height"`           // picture height in pixels
+	PixelMultiplier float64 `json:"pixel_multiplier"` // fish pixel size is multiplier * fish scale
+	CacheDir        string  `json:"cache_dir"`        // rendered pictures directory, empty => aquarium next to database_file
+	MaxCacheFiles   int     `json:"max_cache_files"`  // oldest pictures are removed after this
 }
 
 type CacheConfig struct {
 	StaticFiles int `json:"static_files"` // cache for static files
-	FishesMe    int `json:"fish_me"`      // cache for GET fish:me
 	PixelsLimit int `json:"pixels_limit"` // cache for limit of pixels
+	FishCensus  int `json:"fish_census"`  // recount traits of all fishes for rarity
+	Aquarium    int `json:"aquarium"`     // cache for aquarium picture
+}
+
+// Enabled is false when config has no aquarium section, then GET /fishes/aquarium.png is not served
+func (c *AquariumConfig) Enabled() bool {
+	return *c != AquariumConfig{}
+}
+
+func (c *AquariumConfig) validate(databaseFile string) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	if c.Fishes <= 0 || c.MaxFishes <= 0 {
+		return fmt.Errorf("aquarium.fishes and aquarium.max_fishes must be positive")
+	}
+	if c.Width <= 0 || c.Height <= 0 || c.PixelMultiplier <= 0 {
+		return fmt.Errorf("aquarium.width, aquarium.height and aquarium.pixel_multiplier must be positive")
+	}
+
+	// next to database, otherwise pictures would be written to working directory
+	if c.CacheDir == "" {
+		c.CacheDir = filepath.Join(filepath.Dir(databaseFile), "aquarium")
+	}
+
+	return nil
+}
+
+func (c *ServerConfig) parseProxyConfig() error {
+	switch c.ForwardedHeader {
+	case "":
+		c.ForwardedHeader = XForwardedForHeader
+	case ForwardedHeader, XForwardedForHeader:
+	default:
+		return fmt.Errorf("server.forwarded_header must be %s or %s", ForwardedHeader, XForwardedForHeader)
+	}
+
+	proxies := c.TrustedProxies
+	if len(proxies) == 0 {
+		proxies = defaultTrustedProxies
+	}
+
+	c.trustedProxies = make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %s: %w", proxy, err)
+		}
+		c.trustedProxies = append(c.trustedProxies, prefix.Masked())
+	}
+
+	return nil
+}
+
+func (c *ServerConfig) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range c.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+const defaultClaimTokenTTL = 24 * 60 * 60
+
+func (c *Config) validate() error {
+	if err := c.Aquarium.validate(c.DatabaseFile); err != nil {
+		return err
+	}
+
+	if c.Identity.ClaimTokenTTL <= 0 {
+		c.Identity.ClaimTokenTTL = defaultClaimTokenTTL
+	}
+
+	return c.Server.parseProxyConfig()
 }
 
 func ParseConfig(fileName string) (Config, error) {
@@ -42,7 +214,7 @@ func ParseConfig(fileName string) (Config, error) {
 		return config, err
 	}
 
-	return config, nil
+	return config, config.validate()
 }
 
 func ParseConfigString(rawJson string) (Config, error) {
@@ -51,5 +223,5 @@ func ParseConfigString(rawJson string) (Config, error) {
 		return config, err
 	}
 
-	return config, nil
+	return config, config.validate()
 }
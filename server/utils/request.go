@@ -3,29 +3,126 @@ package utils
 import (
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 )
 
-func GetIPAddr(r *http.Request, checkXFF bool) string {
-	ip := strings.Split(r.RemoteAddr, ":")[0]
+// values of server.forwarded_header
+const (
+	ForwardedHeader     = "Forwarded"
+	XForwardedForHeader = "X-Forwarded-For"
+)
 
-	if !checkXFF {
-		return ip
+// used when server.is_behind_proxy is on and server.trusted_proxies is empty
+var defaultTrustedProxies = []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7"}
+
+// GetIPAddr returns client ip. Headers are used only if request came from trusted proxy:
+// server.client_ip_header if set, otherwise server.forwarded_header from right to left
+// until first address which is not trusted proxy (left ones can be written by client)
+func GetIPAddr(r *http.Request, config *ServerConfig) string {
+	addr, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+
+	if !config.IsBehindProxy || !config.isTrustedProxy(addr) {
+		return addr.String()
+	}
+
+	if config.ClientIPHeader != "" {
+		if headerAddr, ok := parseAddr(strings.TrimSpace(r.Header.Get(config.ClientIPHeader))); ok {
+			return headerAddr.String()
+		}
+		return addr.String()
+	}
+
+	chain := forwardedFor(r, config.ForwardedHeader)
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop, ok := parseAddr(chain[i])
+		if !ok {
+			// unknown or obfuscated hop, trust nothing left of it
+			break
+		}
+
+		addr = hop
+		if !config.isTrustedProxy(hop) {
+			break
+		}
 	}
 
-	if netIp := net.ParseIP(ip); netIp.IsLoopback() || netIp.IsPrivate() {
-		xff := r.Header.Get("X-Forwarded-For")
-		if xff == "" {
-			return ip
+	return addr.String()
+}
+
+// forwardedFor returns chain of addresses from Forwarded (RFC 7239) or X-Forwarded-For.
+// Only header which proxy sets is read, other one comes from client as is
+func forwardedFor(r *http.Request, header string) []string {
+	var chain []string
+
+	if header == ForwardedHeader {
+		for _, value := range r.Header.Values(ForwardedHeader) {
+			for element := range strings.SplitSeq(value, ",") {
+				for pair := range strings.SplitSeq(element, ";") {
+					key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(key, "for") {
+						chain = append(chain, strings.Trim(value, `"`))
+					}
+				}
+			}
 		}
+		return chain
+	}
 
-		xffIp := strings.Split(xff, ",")[0]
-		if net.ParseIP(xffIp) == nil {
-			return ip
+	for _, value := range r.Header.Values(XForwardedForHeader) {
+		for hop := range strings.SplitSeq(value, ",") {
+			chain = append(chain, strings.TrimSpace(hop))
 		}
+	}
+
+	return chain
+}
+
+// GetAddr returns network of client (by server.ipv4_prefix and server.ipv6_prefix),
+// every ip in this network is same client for souls and rate limits
+func GetAddr(r *http.Request, config *ServerConfig) string {
+	return AggregateAddr(GetIPAddr(r, config), config.IPv4Prefix, config.IPv6Prefix)
+}
+
+// AggregateAddr returns ip as is for full prefix, otherwise network like 2001:db8::/64
+func AggregateAddr(ip string, ipv4Prefix, ipv6Prefix int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	bits := ipv6Prefix
+	if addr.Is4() {
+		bits = ipv4Prefix
+	}
+
+	if bits <= 0 || bits >= addr.BitLen() {
+		return addr.String()
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+
+	return prefix.String()
+}
+
+// parseAddr accepts host:port, [host]:port or just host
+func parseAddr(hostport string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
 
-		ip = xffIp
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
 	}
 
-	return ip
+	// ::ffff:1.2.3.4 is ipv4 client of dual stack socket
+	return addr.Unmap().WithZone(""), true
 }
@@ -0,0 +1,24 @@
+package utils
+
+import "strings"
+
+var botUserAgents = []string{
+	"bot", "crawl", "spider", "slurp", "scrapy", "headless", "preview", "facebookexternalhit",
+	"curl", "wget", "python", "go-http-client", "java/", "libwww", "okhttp", "axios", "node-fetch", "httpclient",
+}
+
+// IsBot is true for crawlers, scanners and http libraries (and empty user agent)
+func IsBot(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+
+	userAgent = strings.ToLower(userAgent)
+	for _, bot := range botUserAgents {
+		if strings.Contains(userAgent, bot) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -63,6 +63,43 @@ document.addEventListener("DOMContentLoaded", () => {
     AVAILABLE_COLORS: ["red", "green", "blue", "yellow", "purple", "orange", "black", "white"],
   };
 
+  // proof of work runs in worker, so page dont freeze. Webcrypto is async, so hashes go in batches
+  // (one by one its mostly waiting), until deadline of challenge
+  function proofOfWorkWorker() {
+    const BATCH_SIZE = 256;
+
+    function leadingZeroBits(bytes) {
+      let bits = 0;
+      for (const byte of bytes) {
+        if (byte !== 0) {
+          return bits + Math.clz32(byte) - 24;
+        }
+        bits += 8;
+      }
+      return bits;
+    }
+
+    self.onmessage = async (e) => {
+      const { challenge, difficulty, deadline } = e.data;
+      const encoder = new TextEncoder();
+
+      for (let start = 0; Date.now() < deadline; start += BATCH_SIZE) {
+        const nonces = Array.from({ length: BATCH_SIZE }, (_, i) => String(start + i));
+        const hashes = await Promise.all(
+          nonces.map((nonce) => crypto.subtle.digest("SHA-256", encoder.encode(challenge + nonce))),
+        );
+
+        const found = hashes.findIndex((hash) => leadingZeroBits(new Uint8Array(hash)) >= difficulty);
+        if (found !== -1) {
+          self.postMessage({ nonce: nonces[found] });
+          return;
+        }
+      }
+
+      self.postMessage({ expired: true });
+    };
+  }
+
   class PixelBattle {
     constructor(canvasId, text, font) {
       this.canvas = document.getElementById(canvasId);
@@ -229,10 +266,15 @@ document.addEventListener("DOMContentLoaded", () => {
       }
 
       try {
+        const proof = await this.solveChallenge();
+        if (!proof) {
+          return;
+        }
+
         const response = await fetch("/pixels:paint", {
           method: "POST",
           headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({ x: pixelX, y: pixelY, color: this.color }),
+          body: JSON.stringify({ x: pixelX, y: pixelY, color: this.color, ...proof }),
         });
 
         if (response.ok) {
@@ -248,6 +290,46 @@ document.addEventListener("DOMContentLoaded", () => {
       }
     }
 
+    // proof of work: sha256(challenge + nonce) must start with difficulty zero bits.
+    // Returns null if soul cant paint (no pixels left) or challenge expired before its solved
+    async solveChallenge() {
+      const response = await fetch("/pixels:challenge");
+      if (!response.ok) {
+        const errorData = await response.json();
+        console.error("Failed to get challenge:", JSON.stringify(errorData));
+        return null;
+      }
+
+      const { challenge, difficulty, expires_at } = await response.json();
+      if (!challenge) {
+        return {};
+      }
+
+      // expires_at is server time, client clock can be other
+      const serverNow = Date.parse(response.headers.get("Date")) || Date.now();
+      const deadline = Date.now() + (expires_at * 1000 - serverNow);
+
+      const url = URL.createObjectURL(new Blob([`(${proofOfWorkWorker})()`], { type: "text/javascript" }));
+      const worker = new Worker(url);
+      try {
+        const result = await new Promise((resolve, reject) => {
+          worker.onmessage = (e) => resolve(e.data);
+          worker.onerror = reject;
+          worker.postMessage({ challenge, difficulty, deadline });
+        });
+
+        if (result.expired) {
+          console.error("Failed to solve challenge:", JSON.stringify({ details: "challenge expired, try again" }));
+          return null;
+        }
+
+        return { challenge, nonce: result.nonce };
+      } finally {
+        worker.terminate();
+        URL.revokeObjectURL(url);
+      }
+    }
+
     showColorPicker(x, y) {
       this.hideColorPicker();
 
@@ -313,8 +395,8 @@ document.addEventListener("DOMContentLoaded", () => {
     BUFFER_REFILL_THRESHOLD: 10,
     ADD_FISH_INTERVAL_MS: 1000,
     FISH_API_RETRY_DELAY_MS: 5000,
-    FISH_API_PAGE_SIZE: 100,
-    FISH_API_ENDPOINT: "/fishes?page=",
+    FISH_API_SAMPLE_SIZE: 50,
+    FISH_API_ENDPOINT: "/fishes:random?n=",
     FISH_PIXEL_SIZE_MULTIPLIER: 4,
     FISH_OFFSCREEN_OFFSET: 500,
     FISH_MIN_SPEED: 0.1,
@@ -395,7 +477,6 @@ document.addEventListener("DOMContentLoaded", () => {
       this.canvasHeight = canvasHeight;
       this.fishes = [];
       this.seedBuffer = [];
-      this.currentPage = 1;
       this.isLoading = false;
     }
 
@@ -405,17 +486,12 @@ document.addEventListener("DOMContentLoaded", () => {
       }
       this.isLoading = true;
       try {
-        const response = await fetch(`${INFINITE_CANVAS_CONFIG.FISH_API_ENDPOINT}${this.currentPage}`);
+        const response = await fetch(`${INFINITE_CANVAS_CONFIG.FISH_API_ENDPOINT}${INFINITE_CANVAS_CONFIG.FISH_API_SAMPLE_SIZE}`);
         if (!response.ok) {
           throw new Error(`HTTP error! status: ${response.status}`);
         }
         const data = await response.json();
         this.seedBuffer.push(...data.seeds);
-        if (data.seeds.length < INFINITE_CANVAS_CONFIG.FISH_API_PAGE_SIZE) {
-          this.currentPage = 1; // Loop back to the start
-        } else {
-          this.currentPage++;
-        }
       } catch (error) {
         console.error("Error loading fish seeds:", error);
       } finally {
@@ -795,6 +871,8 @@ document.addEventListener("DOMContentLoaded", () => {
       this.listContainer = null;
       this.controlsContainer = null;
       this.userFishContainer = null;
+      this.searchInput = null;
+      this.searchTimeout = null;
       this.imageCache = new Map();
       this.glossaryPage = 1;
       this.ITEMS_PER_PAGE = 20;
@@ -807,6 +885,14 @@ document.addEventListener("DOMContentLoaded", () => {
       this.listContainer = document.getElementById("glossary-list");
       this.controlsContainer = document.getElementById("glossary-controls");
       this.userFishContainer = document.getElementById("user-fish-container");
+      this.searchInput = document.getElementById("glossary-search");
+
+      if (this.searchInput) {
+        this.searchInput.addEventListener("input", () => {
+          clearTimeout(this.searchTimeout);
+          this.searchTimeout = setTimeout(() => this.search(this.searchInput.value.trim()), 300);
+        });
+      }
 
       if (!this.listContainer || !this.controlsContainer || !this.userFishContainer) {
         console.error("Glossary containers not found");
@@ -853,6 +939,32 @@ document.addEventListener("DOMContentLoaded", () => {
       this.renderControls();
     }
 
+    async search(query) {
+      if (!query) {
+        this.renderPage(1);
+        return;
+      }
+
+      this.listContainer.innerHTML = '<div class="loading-spinner"></div>';
+      this.controlsContainer.innerHTML = "";
+      try {
+        const response = await fetch(`/fishes:search?q=${encodeURIComponent(query)}`);
+        if (!response.ok) {
+          throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        const data = await response.json();
+        const fragment = document.createDocumentFragment();
+        for (const seed of data.seeds) {
+          fragment.appendChild(this.createFishCard(seed, seed === this.app.userFishSeed));
+        }
+        this.listContainer.innerHTML = "";
+        this.listContainer.appendChild(fragment);
+      } catch (error) {
+        console.error("Error searching fish:", error);
+        this.listContainer.innerHTML = "";
+      }
+    }
+
     renderControls() {
       this.controlsContainer.innerHTML = "";
 
@@ -967,6 +1079,7 @@ document.addEventListener("DOMContentLoaded", () => {
     async init() {
       this.setupEventListeners();
       this.loadContent("home");
+      this.getUserFishSeed(); // souls are made only by api, so visitor joins the ocean here
       await this.initCanvases();
     }
 